@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// BuildCommand builds the named modules and everything they depend on
+type BuildCommand struct {
+	fs    *flag.FlagSet
+	flags buildFlags
+}
+
+func NewBuildCommand() *BuildCommand {
+	cmd := &BuildCommand{
+		fs: flag.NewFlagSet("build", flag.ExitOnError),
+	}
+
+	cmd.flags.register(cmd.fs)
+
+	return cmd
+}
+
+func (b *BuildCommand) Name() string { return "build" }
+func (b *BuildCommand) Description() string {
+	return "build modules and their dependencies (foe build <module>...)"
+}
+func (b *BuildCommand) FlagSet() *flag.FlagSet { return b.fs }
+
+func (b *BuildCommand) Run(args []string) error {
+	names, err := parseInterspersed(b.fs, args)
+	if err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+
+	if len(names) == 0 {
+		return fmt.Errorf("usage: foe build [options] <module>...")
+	}
+
+	orchestrator, err := b.flags.setup()
+	if err != nil {
+		return err
+	}
+	defer orchestrator.Close()
+	targets, err := b.flags.matrix()
+	if err != nil {
+		return err
+	}
+	target := b.flags.target()
+
+	// Ctrl-C or kill stops every running hook with its children
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if targets != nil {
+		reports, err := orchestrator.BuildMatrix(ctx, targets, names...)
+		printMatrixSummary(os.Stdout, reports)
+		return err
+	}
+
+	if err := orchestrator.Plan(ctx, target); err != nil {
+		return fmt.Errorf("failed to plan build: %w", err)
+	}
+
+	err = orchestrator.BuildWithDeps(ctx, names, target)
+	printSummary(os.Stdout, orchestrator.Report())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	artifactcache "github.com/73NN0/foe-hammer/internal/orchestrator/adapters/artifact-cache"
+)
+
+type CacheCommand struct {
+	fs       *flag.FlagSet
+	cacheDir string
+	maxSize  string
+	maxAge   time.Duration
+}
+
+func NewCacheCommand() *CacheCommand {
+	cmd := &CacheCommand{
+		fs: flag.NewFlagSet("cache", flag.ExitOnError),
+	}
+
+	cmd.fs.StringVar(&cmd.cacheDir, "cache-dir", defaultCacheDir(), "artifact cache directory")
+	cmd.fs.StringVar(&cmd.maxSize, "max-size", "5G", "gc: max size of the cache (K, M, G suffixes, 0 = no limit)")
+	cmd.fs.DurationVar(&cmd.maxAge, "max-age", 30*24*time.Hour, "gc: remove entries unused for longer (0 = no limit)")
+
+	return cmd
+}
+
+func (c *CacheCommand) Name() string           { return "cache" }
+func (c *CacheCommand) Description() string    { return "manage the artifact cache (foe cache gc)" }
+func (c *CacheCommand) FlagSet() *flag.FlagSet { return c.fs }
+
+func (c *CacheCommand) Run(args []string) error {
+	if len(args) < 1 || args[0] != "gc" {
+		return fmt.Errorf("usage: foe cache gc [options]")
+	}
+
+	if err := c.fs.Parse(args[1:]); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+
+	maxSize, err := parseSize(c.maxSize)
+	if err != nil {
+		return err
+	}
+
+	stats, err := artifactcache.NewDirCache(c.cacheDir).GC(maxSize, c.maxAge)
+	if err != nil {
+		return fmt.Errorf("cache gc: %w", err)
+	}
+
+	fmt.Printf("removed %d entries, %d objects (%d bytes freed), %d bytes left in %s\n",
+		stats.EntriesRemoved, stats.ObjectsRemoved, stats.BytesFreed, stats.BytesLeft, c.cacheDir)
+	return nil
+}
+
+func defaultCacheDir() string {
+	dir, err := artifactcache.DefaultDir()
+	if err != nil {
+		return ""
+	}
+	return dir
+}
+
+// parseSize parses sizes like 512, 100K, 20M or 5G
+func parseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	unit := int64(1)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		unit = 1 << 10
+	case strings.HasSuffix(s, "M"):
+		unit = 1 << 20
+	case strings.HasSuffix(s, "G"):
+		unit = 1 << 30
+	}
+	if unit != 1 {
+		s = s[:len(s)-1]
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * unit, nil
+}
@@ -59,6 +59,10 @@ func NewCLI() *CLI {
 
 	cli.registry.Register(NewHelpCommand(cli.registry))
 	cli.registry.Register(NewOrchestrateCommand())
+	cli.registry.Register(NewBuildCommand())
+	cli.registry.Register(NewPlanCommand())
+	cli.registry.Register(NewOwnerCommand())
+	cli.registry.Register(NewCacheCommand())
 	return cli
 }
 
@@ -81,3 +85,23 @@ func (c *CLI) Run(args []string) error {
 
 	return cmd.Run(cmdArgs)
 }
+
+// parseInterspersed parses flags wherever they are, `foe build app -j 4` like `foe build -j 4 app`:
+// flag stops at the first argument that is not a flag. Everything after -- is an argument.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		if parsed := len(args) - len(rest); parsed > 0 && args[parsed-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
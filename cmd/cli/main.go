@@ -1,12 +1,21 @@
 package main
 
 import (
+	"errors"
 	"os"
+
+	moduleloader "github.com/73NN0/foe-hammer/internal/orchestrator/adapters/module-loader"
 )
 
 func main() {
 
 	if err := NewCLI().Run(os.Args[1:]); err != nil {
+		// broken PKGBUILDs are the user's, not a crash
+		var loadErrs *moduleloader.LoadErrors
+		if errors.As(err, &loadErrs) {
+			printLoadErrors(os.Stderr, loadErrs)
+			os.Exit(1)
+		}
 		panic(err)
 	}
 }
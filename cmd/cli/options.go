@@ -0,0 +1,321 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	configadapters "github.com/73NN0/foe-hammer/internal/config/adapters"
+	configdomain "github.com/73NN0/foe-hammer/internal/config/domain"
+	artifactcache "github.com/73NN0/foe-hammer/internal/orchestrator/adapters/artifact-cache"
+	bashpool "github.com/73NN0/foe-hammer/internal/orchestrator/adapters/bash-pool"
+	buildstate "github.com/73NN0/foe-hammer/internal/orchestrator/adapters/build-state"
+	envcontext "github.com/73NN0/foe-hammer/internal/orchestrator/adapters/context"
+	hookrunner "github.com/73NN0/foe-hammer/internal/orchestrator/adapters/hook-runner"
+	moduleloader "github.com/73NN0/foe-hammer/internal/orchestrator/adapters/module-loader"
+	"github.com/73NN0/foe-hammer/internal/orchestrator/adapters/toolchain"
+	"github.com/73NN0/foe-hammer/internal/orchestrator/adapters/toolchecker"
+	orchestrator "github.com/73NN0/foe-hammer/internal/orchestrator/app"
+	"github.com/73NN0/foe-hammer/internal/orchestrator/domain"
+)
+
+// toolchainsDir holds the toolchain descriptors of a project, <root>/toolchains/<target>.toolchain
+const toolchainsDir = "toolchains"
+
+// projectFlags are the flags shared by every command that loads and plans modules
+type projectFlags struct {
+	hostOs     string
+	hostArch   string
+	targetOs   string
+	targetArch string
+	rootDir    string
+	outDir     string
+	providers  keyValueFlag
+	toolchain  string
+	inheritEnv bool
+	sandbox    bool
+	loader     string
+
+	project    configdomain.ProjectConfig // read by setup
+	toolchains *toolchain.Set             // read by setup
+}
+
+// buildFlags are the flags shared by every command that builds modules
+type buildFlags struct {
+	projectFlags
+	jobs       int
+	force      bool
+	cacheDir   string
+	noCache    bool
+	keepGoing  bool
+	timeout    time.Duration
+	undeclared bool
+	srcCheck   bool
+	srcStrict  bool
+	staging    bool
+	targets    targetListFlag
+}
+
+func (f *projectFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.hostOs, "host-os", runtime.GOOS, "host os name")
+	fs.StringVar(&f.hostArch, "host-arch", runtime.GOARCH, "host architecture name")
+	fs.StringVar(&f.targetOs, "target-os", runtime.GOOS, "target os name")
+	fs.StringVar(&f.targetArch, "target-arch", runtime.GOARCH, "target architecture name")
+	fs.StringVar(&f.rootDir, "root-dir", ".", "root directory")
+	fs.StringVar(&f.outDir, "out-dir", "bin", "output directory")
+	f.providers = keyValueFlag{}
+	fs.Var(f.providers, "provide", "choose the module providing a virtual name, virtual=module (repeatable)")
+	fs.BoolVar(&f.inheritEnv, "inherit-env", false, "give hooks the whole environment instead of a whitelist, keep_env and keepenv=()")
+	fs.BoolVar(&f.sandbox, "sandbox", false, "run hooks with a read-only source tree, no network and a private /tmp (Linux)")
+	fs.StringVar(&f.loader, "loader", "bash", "how PKGBUILDs are read: bash, or static to parse them without running bash when possible")
+	fs.StringVar(&f.toolchain, "toolchain", "", "toolchain of the target, a name from toolchains/ or a .toolchain file (default: picked from the target)")
+}
+
+func (f *buildFlags) register(fs *flag.FlagSet) {
+	f.projectFlags.register(fs)
+	fs.IntVar(&f.jobs, "j", 1, "number of modules built in parallel (0 = one per CPU)")
+	fs.BoolVar(&f.force, "force", false, "rebuild every module, even up to date ones")
+	fs.StringVar(&f.cacheDir, "cache-dir", defaultCacheDir(), "artifact cache directory")
+	fs.BoolVar(&f.keepGoing, "keep-going", false, "keep building modules not downstream of a failure")
+	fs.DurationVar(&f.timeout, "timeout", 0, "kill a module's build() after this duration (0 = none, PKGBUILD timeout= wins)")
+	fs.BoolVar(&f.undeclared, "warn-undeclared", false, "warn about files written next to a module's produces that no module declares")
+	fs.BoolVar(&f.srcCheck, "check-sources", false, "warn about files build() creates, modifies or deletes in the modules dirs")
+	fs.BoolVar(&f.staging, "staging-sysroot", false, "give each module a FOE_SYSROOT holding the headers and libraries of its depends")
+	fs.BoolVar(&f.srcStrict, "strict-sources", false, "fail a module whose build() writes into the modules dirs")
+	fs.BoolVar(&f.noCache, "no-cache", false, "don't restore or store artifacts in the cache")
+	fs.Var(&f.targets, "target", "build for this target into <out-dir>/<target>/, <arch>-<os>, <os>/<arch> or a GNU triple (repeatable)")
+}
+
+// target accepts GNU names, --target-arch x86_64 is amd64
+func (f *projectFlags) target() domain.Target {
+	target := domain.NewTarget()
+	target.OS = domain.NormalizeOS(f.targetOs)
+	target.Arch = domain.NormalizeArch(f.targetArch)
+	return target
+}
+
+// setup creates an orchestrator from the flags and loads the modules of root-dir
+func (f *projectFlags) setup() (*orchestrator.Orchestrator, error) {
+	o, err := f.newOrchestrator()
+	if err != nil {
+		return nil, err
+	}
+	if err := f.load(o, f.target()); err != nil {
+		o.Close()
+		return nil, err
+	}
+	return o, nil
+}
+
+// newOrchestrator creates an orchestrator from the flags, without loading anything
+func (f *projectFlags) newOrchestrator() (*orchestrator.Orchestrator, error) {
+	host := domain.NewHost()
+	host.OS = domain.NormalizeOS(f.hostOs)
+	host.Arch = domain.NormalizeArch(f.hostArch)
+
+	project, err := configadapters.ReadProjectFile(f.rootDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read project config: %w", err)
+	}
+	f.project = project
+
+	toolchains, err := toolchain.LoadDir(filepath.Join(f.rootDir, toolchainsDir))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read toolchains: %w", err)
+	}
+	f.toolchains = toolchains
+	if err := f.overrideToolchain(f.target()); err != nil {
+		return nil, err
+	}
+
+	env := envcontext.NewEnvProvider()
+	env.SetToolchains(toolchains)
+	env.SetKeepEnv(project.KeepEnv)
+
+	// the loader and the runner share their bash workers, see Orchestrator.Close
+	pool := bashpool.New(0)
+
+	runner := hookrunner.NewBashHookRunner()
+	runner.SetInheritEnv(f.inheritEnv)
+	runner.SetSandbox(f.sandbox)
+	runner.SetPool(pool)
+
+	var loader orchestrator.ModuleLoader
+	switch f.loader {
+	case "bash":
+		l := moduleloader.NewBashLoader()
+		l.SetPool(pool)
+		loader = l
+	case "static":
+		l := moduleloader.NewStaticLoader()
+		l.SetPool(pool)
+		loader = l
+	default:
+		pool.Close()
+		return nil, fmt.Errorf("unknown loader %q, expected bash or static", f.loader)
+	}
+
+	o := orchestrator.NewOrchestrator(
+		loader,
+		env,
+		runner,
+		host,
+		toolchecker.NewWhichChecker(),
+	)
+
+	o.SelectProviders(f.providersFor(f.target()))
+
+	if err := o.SetOutput(f.outDir); err != nil {
+		o.Close()
+		return nil, fmt.Errorf("failed to set output directory: %w", err)
+	}
+
+	return o, nil
+}
+
+// overrideToolchain applies --toolchain to target
+func (f *projectFlags) overrideToolchain(target domain.Target) error {
+	if f.toolchain == "" {
+		return nil
+	}
+	tc, err := f.toolchains.Resolve(f.toolchain)
+	if err != nil {
+		return fmt.Errorf("failed to read toolchain: %w", err)
+	}
+	f.toolchains.Override(target, tc)
+	return nil
+}
+
+// load loads the modules of root-dir, resolved for target
+func (f *projectFlags) load(o *orchestrator.Orchestrator, target domain.Target) error {
+	if err := o.LoadFor(f.rootDir, target); err != nil {
+		return fmt.Errorf("failed to load modules from %s: %w", f.rootDir, err)
+	}
+	return nil
+}
+
+// providersFor returns the providers selected for target:
+// project default < project per target < --provide
+func (f *projectFlags) providersFor(target domain.Target) domain.ProviderSelection {
+	providers := f.project.ProvidersFor(target.String())
+	for virtual, module := range f.providers {
+		providers[virtual] = module
+	}
+	return providers
+}
+
+// matrix returns the targets of a multi-target build: --target, or the project targets.
+// nil means a single target build for --target-os/--target-arch, straight into out-dir.
+// Requires: setup must be called first.
+func (f *buildFlags) matrix() ([]domain.Target, error) {
+	if len(f.targets) > 0 {
+		return f.targets, nil
+	}
+
+	targets := make([]domain.Target, 0, len(f.project.Targets))
+	for _, s := range f.project.Targets {
+		target, err := domain.ParseTarget(s)
+		if err != nil {
+			return nil, fmt.Errorf("project targets: %w", err)
+		}
+		targets = append(targets, target)
+	}
+	if len(targets) == 0 {
+		return nil, nil
+	}
+	return targets, nil
+}
+
+// setup also applies the build flags
+func (f *buildFlags) setup() (*orchestrator.Orchestrator, error) {
+	o, err := f.projectFlags.newOrchestrator()
+	if err != nil {
+		return nil, err
+	}
+
+	o.SetJobs(f.jobs)
+	o.SetStateStore(buildstate.NewJSONStore())
+	o.SetForce(f.force)
+	o.SetKeepGoing(f.keepGoing)
+	o.SetTimeout(f.timeout)
+	o.SetWarnUndeclared(f.undeclared)
+	o.SetCheckSources(f.srcCheck)
+	o.SetStrictSources(f.srcStrict)
+	o.SetStagingSysroot(f.staging)
+	if !f.noCache && f.cacheDir != "" {
+		o.SetCache(artifactcache.NewDirCache(f.cacheDir))
+	}
+
+	targets, err := f.matrix()
+	if err != nil {
+		o.Close()
+		return nil, err
+	}
+	// one toolchain can't fit several targets, they each have their toolchains/<target>.toolchain
+	if f.toolchain != "" && len(targets) > 1 {
+		o.Close()
+		return nil, fmt.Errorf("--toolchain applies to a single target, %d are selected", len(targets))
+	}
+	for _, target := range targets {
+		o.SelectTargetProviders(target, f.providersFor(target))
+		if err := f.overrideToolchain(target); err != nil {
+			o.Close()
+			return nil, err
+		}
+	}
+
+	// every target is resolved again by Plan, the first one is enough to load
+	target := f.target()
+	if len(targets) > 0 {
+		target = targets[0]
+	}
+	if err := f.load(o, target); err != nil {
+		o.Close()
+		return nil, err
+	}
+
+	return o, nil
+}
+
+// keyValueFlag collects repeated key=value flags
+type keyValueFlag map[string]string
+
+func (f keyValueFlag) String() string {
+	pairs := make([]string, 0, len(f))
+	for k, v := range f {
+		pairs = append(pairs, k+"="+v)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (f keyValueFlag) Set(value string) error {
+	k, v, ok := strings.Cut(value, "=")
+	if !ok || k == "" || v == "" {
+		return fmt.Errorf("expected key=value, got %q", value)
+	}
+	f[k] = v
+	return nil
+}
+
+// targetListFlag collects repeated --target flags
+type targetListFlag []domain.Target
+
+func (f *targetListFlag) String() string {
+	names := make([]string, 0, len(*f))
+	for _, t := range *f {
+		names = append(names, t.String())
+	}
+	return strings.Join(names, ",")
+}
+
+func (f *targetListFlag) Set(value string) error {
+	target, err := domain.ParseTarget(value)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, target)
+	return nil
+}
@@ -1,26 +1,17 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
-	"runtime"
-
-	"github.com/73NN0/foe-hammer/internal/orchestrator"
-	"github.com/73NN0/foe-hammer/internal/orchestrator/adapters/context"
-	hookrunner "github.com/73NN0/foe-hammer/internal/orchestrator/adapters/hook-runner"
-	moduleloader "github.com/73NN0/foe-hammer/internal/orchestrator/adapters/module-loader"
-	"github.com/73NN0/foe-hammer/internal/orchestrator/adapters/toolchecker"
-	"github.com/73NN0/foe-hammer/internal/orchestrator/domain"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 type OrchestrateCommand struct {
-	fs         *flag.FlagSet
-	hostOs     string
-	hostArch   string
-	targetOs   string
-	targetArch string
-	rootDir    string
-	outDir     string
+	fs    *flag.FlagSet
+	flags buildFlags
 }
 
 func NewOrchestrateCommand() *OrchestrateCommand {
@@ -29,12 +20,7 @@ func NewOrchestrateCommand() *OrchestrateCommand {
 	}
 
 	// Enregistre les flags ICI, dans le constructeur
-	cmd.fs.StringVar(&cmd.hostOs, "host-os", runtime.GOOS, "host os name")
-	cmd.fs.StringVar(&cmd.hostArch, "host-arch", runtime.GOARCH, "host architecture name")
-	cmd.fs.StringVar(&cmd.targetOs, "target-os", runtime.GOOS, "target os name")
-	cmd.fs.StringVar(&cmd.targetArch, "target-arch", runtime.GOARCH, "target architecture name")
-	cmd.fs.StringVar(&cmd.rootDir, "root-dir", ".", "root directory")
-	cmd.fs.StringVar(&cmd.outDir, "out-dir", "bin", "output directory")
+	cmd.flags.register(cmd.fs)
 
 	return cmd
 }
@@ -48,35 +34,34 @@ func (o *OrchestrateCommand) Run(args []string) error {
 		return fmt.Errorf("failed to parse flags: %w", err)
 	}
 
-	host := domain.NewHost()
-	host.OS = o.hostOs
-	host.Arch = o.hostArch
-
-	target := domain.NewTarget()
-	target.OS = o.targetOs
-	target.Arch = o.targetArch
-
-	orchestrator := orchestrator.NewOrchestrator(
-		moduleloader.NewBashLoader(),
-		context.NewEnvProvider(),
-		hookrunner.NewBashHookRunner(),
-		host,
-		toolchecker.NewWhichChecker(),
-	)
-
-	if err := orchestrator.Load(o.rootDir); err != nil {
-		return fmt.Errorf("failed to load modules from %s: %w", o.rootDir, err)
+	orchestrator, err := o.flags.setup()
+	if err != nil {
+		return err
 	}
+	defer orchestrator.Close()
+	targets, err := o.flags.matrix()
+	if err != nil {
+		return err
+	}
+	target := o.flags.target()
 
-	if err := orchestrator.SetOutput(o.outDir); err != nil {
-		return fmt.Errorf("failed to set output directory: %w", err)
+	// Ctrl-C or kill stops every running hook with its children
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if targets != nil {
+		reports, err := orchestrator.BuildMatrix(ctx, targets)
+		printMatrixSummary(os.Stdout, reports)
+		return err
 	}
 
-	if err := orchestrator.Plan(target); err != nil {
+	if err := orchestrator.Plan(ctx, target); err != nil {
 		return fmt.Errorf("failed to plan build: %w", err)
 	}
 
-	if err := orchestrator.BuildAll(target); err != nil {
+	err = orchestrator.BuildAll(ctx, target)
+	printSummary(os.Stdout, orchestrator.Report())
+	if err != nil {
 		return err
 	}
 
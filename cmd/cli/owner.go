@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// OwnerCommand tells which module produces a file of the out dir
+type OwnerCommand struct {
+	fs    *flag.FlagSet
+	flags projectFlags
+}
+
+func NewOwnerCommand() *OwnerCommand {
+	cmd := &OwnerCommand{
+		fs: flag.NewFlagSet("owner", flag.ExitOnError),
+	}
+
+	cmd.flags.register(cmd.fs)
+
+	return cmd
+}
+
+func (c *OwnerCommand) Name() string { return "owner" }
+func (c *OwnerCommand) Description() string {
+	return "show which module produces a file (foe owner bin/app)"
+}
+func (c *OwnerCommand) FlagSet() *flag.FlagSet { return c.fs }
+
+func (c *OwnerCommand) Run(args []string) error {
+	paths, err := parseInterspersed(c.fs, args)
+	if err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+
+	if len(paths) == 0 {
+		return fmt.Errorf("usage: foe owner [options] <path>...")
+	}
+
+	orchestrator, err := c.flags.setup()
+	if err != nil {
+		return err
+	}
+	defer orchestrator.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := orchestrator.Plan(ctx, c.flags.target()); err != nil {
+		return fmt.Errorf("failed to plan build: %w", err)
+	}
+
+	for _, path := range paths {
+		m, err := orchestrator.Owner(path)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: %s (%s)\n", path, m.Name, m.Path)
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+)
+
+// PlanCommand shows what would be built for the target, without building anything
+type PlanCommand struct {
+	fs    *flag.FlagSet
+	flags projectFlags
+}
+
+func NewPlanCommand() *PlanCommand {
+	cmd := &PlanCommand{
+		fs: flag.NewFlagSet("plan", flag.ExitOnError),
+	}
+
+	cmd.flags.register(cmd.fs)
+
+	return cmd
+}
+
+func (c *PlanCommand) Name() string { return "plan" }
+func (c *PlanCommand) Description() string {
+	return "show the build order and the modules excluded for the target"
+}
+func (c *PlanCommand) FlagSet() *flag.FlagSet { return c.fs }
+
+func (c *PlanCommand) Run(args []string) error {
+	if err := c.fs.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+
+	orchestrator, err := c.flags.setup()
+	if err != nil {
+		return err
+	}
+	defer orchestrator.Close()
+	target := c.flags.target()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := orchestrator.Plan(ctx, target); err != nil {
+		return fmt.Errorf("failed to plan build: %w", err)
+	}
+
+	fmt.Printf("Plan for %s:\n", target)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  MODULE\tPRODUCES")
+	for _, name := range orchestrator.Order() {
+		m, err := orchestrator.Module(name)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(tw, "  %s\t%s\n", name, strings.Join(m.Produces, " "))
+	}
+	tw.Flush()
+
+	excluded := orchestrator.Excluded()
+	if len(excluded) == 0 {
+		return nil
+	}
+
+	fmt.Printf("\nExcluded for %s:\n", target)
+	tw = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  MODULE\tREASON")
+	for _, e := range excluded {
+		fmt.Fprintf(tw, "  %s\t%s\n", e.Name, e.Reason)
+	}
+	tw.Flush()
+
+	return nil
+}
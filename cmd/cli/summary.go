@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	moduleloader "github.com/73NN0/foe-hammer/internal/orchestrator/adapters/module-loader"
+	"github.com/73NN0/foe-hammer/internal/orchestrator/domain"
+)
+
+// printSummary prints one line per module with its status and error
+func printSummary(w io.Writer, report *domain.BuildReport) {
+	if report == nil {
+		return
+	}
+
+	fmt.Fprintln(w, "\nSummary:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  MODULE\tSTATUS\tERROR")
+	for _, r := range report.Results {
+		msg := ""
+		if r.Err != nil {
+			// keep the table readable, hooks output is already on stderr
+			msg, _, _ = strings.Cut(r.Err.Error(), "\n")
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%s\n", r.Name, r.Status, msg)
+	}
+	tw.Flush()
+
+	fmt.Fprintf(w, "%d built, %d up to date, %d cached, %d failed, %d skipped\n",
+		report.Count(domain.BuildStatusBuilt),
+		report.Count(domain.BuildStatusUpToDate),
+		report.Count(domain.BuildStatusCached),
+		report.Count(domain.BuildStatusFailed),
+		report.Count(domain.BuildStatusSkipped),
+	)
+}
+
+// printMatrixSummary prints the summary of every target, then one line per target
+func printMatrixSummary(w io.Writer, reports []domain.TargetReport) {
+	for _, r := range reports {
+		if r.Report != nil {
+			fmt.Fprintf(w, "\n[%s]", r.Target)
+			printSummary(w, r.Report)
+		}
+	}
+
+	fmt.Fprintln(w, "\nTargets:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  TARGET\tRESULT\tERROR")
+	for _, r := range reports {
+		result, msg := "pass", ""
+		if r.Err != nil {
+			result = "fail"
+			msg, _, _ = strings.Cut(r.Err.Error(), "\n")
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%s\n", r.Target, result, msg)
+	}
+	tw.Flush()
+}
+
+// printLoadErrors prints every PKGBUILD that failed to load, located like a compiler would,
+// with what bash printed reading it indented below
+func printLoadErrors(w io.Writer, errs *moduleloader.LoadErrors) {
+	for _, e := range errs.Errors {
+		loc := e.Path
+		if e.Line > 0 {
+			loc = fmt.Sprintf("%s:%d:%d", e.Path, e.Line, e.Col)
+		}
+		fmt.Fprintf(w, "%s: %s\n", loc, e.Msg)
+		if e.Stderr != "" {
+			for _, line := range strings.Split(e.Stderr, "\n") {
+				fmt.Fprintf(w, "    | %s\n", line)
+			}
+		}
+	}
+	if len(errs.Errors) == 1 {
+		fmt.Fprintln(w, "1 PKGBUILD failed to load")
+	} else {
+		fmt.Fprintf(w, "%d PKGBUILDs failed to load\n", len(errs.Errors))
+	}
+}
@@ -2,9 +2,27 @@ package stdio
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 )
 
+// DetailedError est une erreur qui porte des détails structurés (ex: les PKGBUILDs en erreur),
+// publiés sous "details" à côté du message.
+type DetailedError interface {
+	error
+	Details() any
+}
+
+// errorData construit le payload d'un échec.
+func errorData(err error) map[string]any {
+	data := map[string]any{"error": err.Error()}
+	var detailed DetailedError
+	if errors.As(err, &detailed) {
+		data["details"] = detailed.Details()
+	}
+	return data
+}
+
 // HandlerResult encapsule le résultat d'un handler (succès ou échec).
 type HandlerResult struct {
 	successType string
@@ -19,7 +37,7 @@ func (r HandlerResult) Publish(msg Message, pub Publisher, eventTopic string) er
 		return pub.Publish(*msg.Reply(r.successType, r.payload, eventTopic))
 	}
 
-	data := map[string]any{"error": r.err.Error()}
+	data := errorData(r.err)
 	if extra, ok := r.payload.(map[string]any); ok {
 		for k, v := range extra {
 			data[k] = v
@@ -37,10 +37,9 @@ func (s *Server) Serve(r io.Reader, w io.Writer) error {
 			continue
 		}
 		if err := s.config.Handler(msg, pub); err != nil {
-			_ = pub.Publish((*msg.ReplySameTopic(msg.Type+"Failed", map[string]any{
-				"error":        err.Error(),
-				"command_type": msg.Type,
-			})))
+			data := errorData(err)
+			data["command_type"] = msg.Type
+			_ = pub.Publish(*msg.ReplySameTopic(msg.Type+"Failed", data))
 		}
 	}
 }
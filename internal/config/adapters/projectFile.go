@@ -0,0 +1,46 @@
+package adapters
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/73NN0/foe-hammer/internal/config/domain"
+)
+
+// ProjectFileName est le fichier de config optionnel à la racine d'un projet.
+const ProjectFileName = "foe.json"
+
+// ReadProjectFile lit <rootDir>/foe.json.
+// Sans fichier, retourne la config par défaut du projet.
+func ReadProjectFile(rootDir string) (domain.ProjectConfig, error) {
+	absRoot, err := filepath.Abs(rootDir)
+	if err != nil {
+		return domain.ProjectConfig{}, err
+	}
+
+	cfg := domain.ProjectConfig{}
+	path := filepath.Join(absRoot, ProjectFileName)
+
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		// pas de fichier, valeurs par défaut
+	case err != nil:
+		return domain.ProjectConfig{}, fmt.Errorf("reading %s: %w", path, err)
+	default:
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return domain.ProjectConfig{}, fmt.Errorf("%w: %s: %w", domain.ErrInvalid, path, err)
+		}
+	}
+
+	// le fichier est toujours à la racine, il ne choisit pas son RootDir
+	cfg.RootDir = absRoot
+	if err := domain.Validate(&cfg); err != nil {
+		return domain.ProjectConfig{}, err
+	}
+	return cfg, nil
+}
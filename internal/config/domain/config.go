@@ -19,6 +19,15 @@ type ProjectConfig struct {
 	ManifestFilename string   `json:"manifest_filename"`
 	IgnoreDirs       []string `json:"ignore_dirs"`
 	OutDirDefault    string   `json:"out_dir_default"`
+
+	// Providers choisit le module qui fournit un nom virtuel (provides=), par défaut
+	Providers map[string]string `json:"providers,omitempty"`
+	// TargetProviders surcharge Providers pour une target ("amd64-linux")
+	TargetProviders map[string]map[string]string `json:"target_providers,omitempty"`
+	// Targets liste les targets construites par défaut ("amd64-linux", "linux/arm64"), chacune dans <out_dir>/<target>/
+	Targets []string `json:"targets,omitempty"`
+	// KeepEnv liste les variables d'environnement passées aux hooks, en plus de keepenv=() des PKGBUILD
+	KeepEnv []string `json:"keep_env,omitempty"`
 }
 
 const (
@@ -51,6 +60,18 @@ func Validate(config *ProjectConfig) error {
 	return nil
 }
 
+// ProvidersFor retourne les providers pour une target : ceux de la target surchargent ceux par défaut.
+func (c ProjectConfig) ProvidersFor(target string) map[string]string {
+	providers := make(map[string]string, len(c.Providers))
+	for virtual, module := range c.Providers {
+		providers[virtual] = module
+	}
+	for virtual, module := range c.TargetProviders[target] {
+		providers[virtual] = module
+	}
+	return providers
+}
+
 func isAbsolutePath(path string) bool {
 	p := filepath.Clean(path)
 
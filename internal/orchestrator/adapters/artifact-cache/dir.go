@@ -0,0 +1,345 @@
+package artifactcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DirCache is a content-addressed cache of build artifacts on the local disk.
+//
+// Layout:
+//
+//	<root>/objects/<2 first hex>/<sha256>  file contents, shared between entries
+//	<root>/entries/<key>.json              produces of a module, key is its fingerprint
+//
+// The mtime of an entry is its last use, gc evicts the least recently used ones.
+type DirCache struct {
+	root string
+}
+
+type entry struct {
+	Files []entryFile `json:"files"`
+}
+
+type entryFile struct {
+	Path   string      `json:"path"` // relative to the out dir
+	Object string      `json:"object"`
+	Mode   fs.FileMode `json:"mode"`
+}
+
+// GCStats tells what a GC run removed and what is left
+type GCStats struct {
+	EntriesRemoved int
+	ObjectsRemoved int
+	BytesFreed     int64
+	BytesLeft      int64
+}
+
+func NewDirCache(root string) *DirCache {
+	return &DirCache{root: root}
+}
+
+// DefaultDir returns ~/.cache/foe (or the platform user cache dir)
+func DefaultDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "foe"), nil
+}
+
+func (c *DirCache) Root() string {
+	return c.root
+}
+
+// Restore copies the cached produces of key into outDir.
+// It returns false, without error, on a cache miss.
+func (c *DirCache) Restore(key string, produces []string, outDir string) (bool, error) {
+	e, err := c.readEntry(key)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// the entry must hold exactly what the module declares
+	paths := make([]string, 0, len(e.Files))
+	for _, f := range e.Files {
+		paths = append(paths, f.Path)
+	}
+	if !slices.Equal(paths, produces) {
+		return false, nil
+	}
+
+	for _, f := range e.Files {
+		if _, err := os.Stat(c.objectPath(f.Object)); err != nil {
+			// object evicted under our feet, treat as a miss
+			return false, nil
+		}
+	}
+
+	for _, f := range e.Files {
+		dst := filepath.Join(outDir, f.Path)
+		if err := copyFile(c.objectPath(f.Object), dst, f.Mode); err != nil {
+			return false, fmt.Errorf("restoring %s: %w", f.Path, err)
+		}
+	}
+
+	now := time.Now()
+	_ = os.Chtimes(c.entryPath(key), now, now)
+	return true, nil
+}
+
+// Store saves the produces found in outDir under key
+func (c *DirCache) Store(key string, produces []string, outDir string) error {
+	e := entry{Files: make([]entryFile, 0, len(produces))}
+
+	for _, produce := range produces {
+		src := filepath.Join(outDir, produce)
+		info, err := os.Stat(src)
+		if err != nil {
+			return fmt.Errorf("caching %s: %w", produce, err)
+		}
+
+		object, err := c.storeObject(src)
+		if err != nil {
+			return fmt.Errorf("caching %s: %w", produce, err)
+		}
+
+		e.Files = append(e.Files, entryFile{Path: produce, Object: object, Mode: info.Mode().Perm()})
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return writeAtomic(c.entryPath(key), data, 0644)
+}
+
+// GC removes entries not used for more than maxAge, then the least recently used ones
+// until the objects fit in maxSize bytes, then every object no entry refers to.
+// A zero maxAge or maxSize disables that limit.
+func (c *DirCache) GC(maxSize int64, maxAge time.Duration) (GCStats, error) {
+	var stats GCStats
+
+	type usedEntry struct {
+		key     string
+		lastUse time.Time
+		entry   entry
+	}
+
+	dirEntries, err := os.ReadDir(filepath.Join(c.root, "entries"))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return stats, err
+	}
+
+	var entries []usedEntry
+	for _, d := range dirEntries {
+		key, ok := strings.CutSuffix(d.Name(), ".json")
+		if !ok {
+			continue
+		}
+		info, err := d.Info()
+		if err != nil {
+			continue
+		}
+		e, err := c.readEntry(key)
+		if err != nil {
+			// corrupted entry, drop it
+			os.Remove(c.entryPath(key))
+			stats.EntriesRemoved++
+			continue
+		}
+		entries = append(entries, usedEntry{key: key, lastUse: info.ModTime(), entry: e})
+	}
+
+	// most recently used first
+	slices.SortFunc(entries, func(a, b usedEntry) int {
+		return b.lastUse.Compare(a.lastUse)
+	})
+
+	sizes, err := c.objectSizes()
+	if err != nil {
+		return stats, err
+	}
+
+	// keep entries while they are young enough and fit in maxSize
+	kept := make(map[string]bool)
+	var keptSize int64
+	for _, e := range entries {
+		keep := maxAge <= 0 || time.Since(e.lastUse) <= maxAge
+
+		var added int64
+		for _, f := range e.entry.Files {
+			if !kept[f.Object] {
+				added += sizes[f.Object]
+			}
+		}
+		if keep && maxSize > 0 && keptSize+added > maxSize {
+			keep = false
+		}
+
+		if !keep {
+			if err := os.Remove(c.entryPath(e.key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return stats, err
+			}
+			stats.EntriesRemoved++
+			continue
+		}
+
+		for _, f := range e.entry.Files {
+			kept[f.Object] = true
+		}
+		keptSize += added
+	}
+
+	// sweep unreferenced objects
+	for object, size := range sizes {
+		if kept[object] {
+			continue
+		}
+		if err := os.Remove(c.objectPath(object)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return stats, err
+		}
+		stats.ObjectsRemoved++
+		stats.BytesFreed += size
+	}
+	stats.BytesLeft = keptSize
+
+	return stats, nil
+}
+
+func (c *DirCache) readEntry(key string) (entry, error) {
+	var e entry
+	data, err := os.ReadFile(c.entryPath(key))
+	if err != nil {
+		return e, err
+	}
+	if err := json.Unmarshal(data, &e); err != nil {
+		return e, fmt.Errorf("decoding cache entry %s: %w", key, err)
+	}
+	return e, nil
+}
+
+// storeObject copies src into the objects dir and returns its content hash
+func (c *DirCache) storeObject(src string) (string, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	object := hex.EncodeToString(h.Sum(nil))
+
+	if _, err := os.Stat(c.objectPath(object)); err == nil {
+		// same content already cached
+		return object, nil
+	}
+
+	if err := copyFile(src, c.objectPath(object), 0644); err != nil {
+		return "", err
+	}
+	return object, nil
+}
+
+func (c *DirCache) objectSizes() (map[string]int64, error) {
+	sizes := make(map[string]int64)
+	err := filepath.WalkDir(filepath.Join(c.root, "objects"), func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return filepath.SkipAll
+		}
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(d.Name(), ".tmp") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		sizes[d.Name()] = info.Size()
+		return nil
+	})
+	return sizes, err
+}
+
+func (c *DirCache) entryPath(key string) string {
+	return filepath.Join(c.root, "entries", key+".json")
+}
+
+func (c *DirCache) objectPath(object string) string {
+	return filepath.Join(c.root, "objects", object[:2], object)
+}
+
+// copyFile copies through a temp file so readers never see a partial file
+func copyFile(src, dst string, mode fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	// unique temp name, parallel builds may store the same object at once
+	out, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := out.Name()
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Chmod(tmp, mode); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
+
+func writeAtomic(path string, data []byte, mode fs.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, mode)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
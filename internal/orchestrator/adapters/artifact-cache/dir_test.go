@@ -0,0 +1,102 @@
+package artifactcache_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	artifactcache "github.com/73NN0/foe-hammer/internal/orchestrator/adapters/artifact-cache"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStoreRestore(t *testing.T) {
+	cache := artifactcache.NewDirCache(t.TempDir())
+	produces := []string{"lib/liba.a", "bin/app"}
+
+	outA := t.TempDir()
+	writeFile(t, filepath.Join(outA, "lib/liba.a"), "archive")
+	writeFile(t, filepath.Join(outA, "bin/app"), "binary")
+
+	if err := cache.Store("key1", produces, outA); err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+
+	outB := t.TempDir()
+
+	// unknown key
+	if ok, err := cache.Restore("key2", produces, outB); err != nil || ok {
+		t.Fatalf("expected a miss, got %v %v", ok, err)
+	}
+
+	// produces changed
+	if ok, err := cache.Restore("key1", []string{"lib/liba.a"}, outB); err != nil || ok {
+		t.Fatalf("expected a miss, got %v %v", ok, err)
+	}
+
+	ok, err := cache.Restore("key1", produces, outB)
+	if err != nil || !ok {
+		t.Fatalf("expected a hit, got %v %v", ok, err)
+	}
+
+	got, err := os.ReadFile(filepath.Join(outB, "bin/app"))
+	if err != nil || string(got) != "binary" {
+		t.Fatalf("bin/app not restored: %q %v", got, err)
+	}
+	info, err := os.Stat(filepath.Join(outB, "bin/app"))
+	if err != nil || info.Mode().Perm()&0100 == 0 {
+		t.Errorf("expected bin/app to stay executable, got %v", info.Mode())
+	}
+}
+
+func TestGC(t *testing.T) {
+	root := t.TempDir()
+	cache := artifactcache.NewDirCache(root)
+
+	out := t.TempDir()
+	writeFile(t, filepath.Join(out, "lib/old.a"), "old artifact")
+	writeFile(t, filepath.Join(out, "lib/new.a"), "new artifact")
+
+	if err := cache.Store("old", []string{"lib/old.a"}, out); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Store("new", []string{"lib/new.a"}, out); err != nil {
+		t.Fatal(err)
+	}
+
+	// old was last used two days ago
+	twoDaysAgo := time.Now().Add(-48 * time.Hour)
+	os.Chtimes(filepath.Join(root, "entries", "old.json"), twoDaysAgo, twoDaysAgo)
+
+	stats, err := cache.GC(0, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("GC: %v", err)
+	}
+	if stats.EntriesRemoved != 1 || stats.ObjectsRemoved != 1 {
+		t.Errorf("expected 1 entry and 1 object removed, got %+v", stats)
+	}
+
+	if ok, _ := cache.Restore("old", []string{"lib/old.a"}, t.TempDir()); ok {
+		t.Error("old entry should have been evicted")
+	}
+	if ok, _ := cache.Restore("new", []string{"lib/new.a"}, t.TempDir()); !ok {
+		t.Error("new entry should have been kept")
+	}
+
+	// size limit evicts everything that doesn't fit
+	if _, err := cache.GC(1, 0); err != nil {
+		t.Fatalf("GC: %v", err)
+	}
+	if ok, _ := cache.Restore("new", []string{"lib/new.a"}, t.TempDir()); ok {
+		t.Error("new entry should have been evicted by size")
+	}
+}
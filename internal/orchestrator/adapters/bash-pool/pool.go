@@ -0,0 +1,243 @@
+package bashpool
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Pool evaluates scripts in long-lived bash processes, instead of starting bash for each one.
+// Every script runs in its own subshell, so what a PKGBUILD sets doesn't leak into the next one.
+// Workers are started on first use, up to the size of the pool.
+type Pool struct {
+	workers chan *worker // nil for a worker not started yet
+}
+
+// Result is what a script printed and how it exited
+type Result struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+}
+
+// New returns a pool of size workers, one per CPU when size <= 0
+func New(size int) *Pool {
+	if size <= 0 {
+		size = runtime.NumCPU()
+	}
+	p := &Pool{workers: make(chan *worker, size)}
+	for range size {
+		p.workers <- nil
+	}
+	return p
+}
+
+// Size is how many scripts can run at once
+func (p *Pool) Size() int {
+	return cap(p.workers)
+}
+
+// Run runs script in dir with env as its whole environment, or the one of foe when env is nil.
+// Scripts read nothing on stdin. When ctx is done the script is killed with its worker.
+func (p *Pool) Run(ctx context.Context, dir, script string, env []string) (Result, error) {
+	var w *worker
+	select {
+	case w = <-p.workers:
+	case <-ctx.Done():
+		return Result{}, context.Cause(ctx)
+	}
+
+	if w == nil {
+		var err error
+		if w, err = startWorker(); err != nil {
+			p.workers <- nil
+			return Result{}, err
+		}
+	}
+
+	res, err := w.run(ctx, dir, script, env)
+	if err != nil {
+		// the protocol may be out of sync, start a new one next time
+		w.kill()
+		w = nil
+	}
+	p.workers <- w
+	return res, err
+}
+
+// Close stops the workers once their scripts are done, the pool starts new ones if used again
+func (p *Pool) Close() error {
+	workers := make([]*worker, 0, cap(p.workers))
+	for range cap(p.workers) {
+		workers = append(workers, <-p.workers)
+	}
+	for _, w := range workers {
+		if w != nil {
+			w.close()
+		}
+		p.workers <- nil
+	}
+	return nil
+}
+
+// worker is a bash reading the scripts to run on its stdin:
+//
+//	( cd dir; script ) >dir/<n>.out 2>dir/<n>.err </dev/null
+//	printf '<nonce> %d\n' $?
+//
+// The output of the script goes to files of its own, so a background child still holding
+// stdout or stderr (cc ... &) neither blocks the worker nor gets mixed with the next script.
+// The worker sets no variable nor function, the subshell of a script starts from a fresh bash.
+type worker struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	nonce  string
+	dir    string // outputs of the scripts
+	n      int    // scripts run
+	once   sync.Once
+}
+
+func startWorker() (*worker, error) {
+	dir, err := os.MkdirTemp("", "foe-bash-")
+	if err != nil {
+		return nil, fmt.Errorf("starting bash worker: %w", err)
+	}
+
+	cmd := exec.Command("bash", "--noprofile", "--norc", "-s")
+	setProcessGroup(cmd)
+	// errors of the worker itself, those of the scripts are in Result
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("starting bash worker: %w", err)
+	}
+
+	// a script printing it by chance would be quite a feat
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+
+	return &worker{
+		cmd:    cmd,
+		stdin:  stdin,
+		stdout: bufio.NewReader(stdout),
+		nonce:  "__foe_" + hex.EncodeToString(nonce),
+		dir:    dir,
+	}, nil
+}
+
+func (w *worker) request(dir, script string, env []string, stdout, stderr string) string {
+	var b strings.Builder
+	b.WriteString("(\n")
+	if env != nil {
+		b.WriteString("for __foe_v in $(compgen -e); do unset \"$__foe_v\" 2>/dev/null; done; unset __foe_v\n")
+		for _, kv := range env {
+			fmt.Fprintf(&b, "export %s\n", shellQuote(kv))
+		}
+	}
+	fmt.Fprintf(&b, "cd %s || exit\n", shellQuote(dir))
+	b.WriteString(script)
+	fmt.Fprintf(&b, "\n) >%s 2>%s </dev/null\n", shellQuote(stdout), shellQuote(stderr))
+	fmt.Fprintf(&b, "printf '%s %%d\\n' $?\n", w.nonce)
+	return b.String()
+}
+
+func (w *worker) run(ctx context.Context, dir, script string, env []string) (Result, error) {
+	stop := context.AfterFunc(ctx, w.kill)
+	defer stop()
+
+	// new files for each script, a background child of the previous one may still write in its own
+	w.n++
+	stdout := filepath.Join(w.dir, strconv.Itoa(w.n)+".out")
+	stderr := filepath.Join(w.dir, strconv.Itoa(w.n)+".err")
+	defer os.Remove(stdout)
+	defer os.Remove(stderr)
+
+	if _, err := io.WriteString(w.stdin, w.request(dir, script, env, stdout, stderr)); err != nil {
+		return Result{}, w.failed(ctx, err)
+	}
+
+	var res Result
+	for {
+		line, err := w.readLine()
+		if err != nil {
+			return Result{}, w.failed(ctx, err)
+		}
+		// anything else is a worker error, already on stderr
+		if code, ok := strings.CutPrefix(line, w.nonce+" "); ok {
+			res.ExitCode, _ = strconv.Atoi(code)
+			break
+		}
+	}
+
+	out, err := os.ReadFile(stdout)
+	if err != nil {
+		return Result{}, fmt.Errorf("bash worker: %w", err)
+	}
+	errOut, err := os.ReadFile(stderr)
+	if err != nil {
+		return Result{}, fmt.Errorf("bash worker: %w", err)
+	}
+	res.Stdout = string(out)
+	res.Stderr = strings.TrimSpace(string(errOut))
+	return res, nil
+}
+
+func (w *worker) readLine() (string, error) {
+	line, err := w.stdout.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(line, "\n"), nil
+}
+
+func (w *worker) failed(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return context.Cause(ctx)
+	}
+	return fmt.Errorf("bash worker: %w", err)
+}
+
+// kill stops the worker and the script it runs
+func (w *worker) kill() {
+	w.once.Do(func() {
+		killProcessGroup(w.cmd)
+		w.stdin.Close()
+		go w.cmd.Wait()
+		os.RemoveAll(w.dir)
+	})
+}
+
+// close lets bash exit on the end of its stdin
+func (w *worker) close() {
+	w.once.Do(func() {
+		w.stdin.Close()
+		w.cmd.Wait()
+		os.RemoveAll(w.dir)
+	})
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
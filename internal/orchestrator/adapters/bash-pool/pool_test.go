@@ -0,0 +1,142 @@
+package bashpool_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	bashpool "github.com/73NN0/foe-hammer/internal/orchestrator/adapters/bash-pool"
+)
+
+func TestRun(t *testing.T) {
+	pool := bashpool.New(1)
+	defer pool.Close()
+	dir := t.TempDir()
+
+	tests := []struct {
+		name   string
+		script string
+		env    []string
+		want   bashpool.Result
+	}{
+		{
+			name:   "stdout, stderr and exit code",
+			script: `echo out; echo err >&2; exit 3`,
+			want:   bashpool.Result{Stdout: "out\n", Stderr: "err", ExitCode: 3},
+		},
+		{
+			name:   "no trailing newline",
+			script: `printf 'a\nb'`,
+			want:   bashpool.Result{Stdout: "a\nb"},
+		},
+		{
+			name:   "runs in dir",
+			script: `pwd`,
+			want:   bashpool.Result{Stdout: dir + "\n"},
+		},
+		{
+			name:   "leaks nothing to the next script",
+			script: `x=1; f() { :; }; export LEAK=1`,
+		},
+		{
+			name:   "next script",
+			script: `echo "${x:-unset} $(type -t f || echo nofunc) ${LEAK:-clean}"`,
+			want:   bashpool.Result{Stdout: "unset nofunc clean\n"},
+		},
+		{
+			name:   "env replaces the environment",
+			script: `echo "$A ${HOME:-nohome}"`,
+			env:    []string{"A=it's set", "PATH=/usr/bin:/bin"},
+			want:   bashpool.Result{Stdout: "it's set nohome\n"},
+		},
+		{
+			name:   "sees nothing of the worker",
+			script: `echo "$(compgen -v __foe)$(declare -F)"`,
+			env:    []string{"PATH=/usr/bin:/bin"},
+			want:   bashpool.Result{Stdout: "\n"},
+		},
+		{
+			name:   "stdin is not the worker's",
+			script: `read -r line; echo "read: $line"`,
+			want:   bashpool.Result{Stdout: "read: \n", ExitCode: 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := pool.Run(context.Background(), dir, tt.script, tt.env)
+			if err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// cc ... & in a hook, the script returns before its child is done with stdout and stderr
+func TestRunBackgroundChild(t *testing.T) {
+	pool := bashpool.New(1)
+	defer pool.Close()
+
+	start := time.Now()
+	res, err := pool.Run(context.Background(), t.TempDir(), `sleep 3 >&2 & echo started`, nil)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if res.Stdout != "started\n" {
+		t.Errorf("got stdout %q", res.Stdout)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("waited for the background child, took %s", elapsed)
+	}
+}
+
+func TestRunConcurrent(t *testing.T) {
+	pool := bashpool.New(3)
+	defer pool.Close()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 50)
+	for i := range 50 {
+		wg.Go(func() {
+			res, err := pool.Run(context.Background(), t.TempDir(), fmt.Sprintf("echo %d", i), nil)
+			if err == nil && res.Stdout != fmt.Sprintf("%d\n", i) {
+				err = fmt.Errorf("script %d got %q", i, res.Stdout)
+			}
+			errs <- err
+		})
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestRunCanceled(t *testing.T) {
+	pool := bashpool.New(1)
+	defer pool.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := pool.Run(ctx, t.TempDir(), `sleep 30`, nil); err == nil {
+		t.Fatal("expected an error from a canceled script")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("script was not killed in time, took %s", elapsed)
+	}
+
+	// the killed worker is replaced
+	res, err := pool.Run(context.Background(), t.TempDir(), `echo again`, nil)
+	if err != nil || res.Stdout != "again\n" {
+		t.Errorf("pool unusable after a cancellation: %+v, %v", res, err)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package bashpool
+
+import "os/exec"
+
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// no process groups here, only bash itself is killed
+func killProcessGroup(cmd *exec.Cmd) {
+	if cmd.Process != nil {
+		_ = cmd.Process.Kill()
+	}
+}
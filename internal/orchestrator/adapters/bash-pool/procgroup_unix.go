@@ -0,0 +1,21 @@
+//go:build unix
+
+package bashpool
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup puts the worker in its own process group,
+// so what a canceled script started dies with it
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+func killProcessGroup(cmd *exec.Cmd) {
+	if cmd.Process == nil {
+		return
+	}
+	_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
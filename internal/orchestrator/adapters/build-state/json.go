@@ -0,0 +1,67 @@
+package buildstate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/73NN0/foe-hammer/internal/orchestrator/domain"
+)
+
+const (
+	stateDir  = ".foe"
+	stateFile = "state.json"
+)
+
+// JSONStore persists the build state as <outDir>/.foe/state.json
+type JSONStore struct{}
+
+func NewJSONStore() *JSONStore {
+	return &JSONStore{}
+}
+
+// Load returns an empty state when the out dir was never built
+func (s *JSONStore) Load(outDir string) (*domain.BuildState, error) {
+	data, err := os.ReadFile(statePath(outDir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return domain.NewBuildState(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading build state: %w", err)
+	}
+
+	state := domain.NewBuildState()
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("decoding build state %s: %w", statePath(outDir), err)
+	}
+	if state.Modules == nil {
+		state.Modules = make(map[string]domain.ModuleState)
+	}
+	return state, nil
+}
+
+// Save writes the state atomically so an interrupted build never leaves a truncated file
+func (s *JSONStore) Save(outDir string, state *domain.BuildState) error {
+	path := statePath(outDir)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("creating state dir: %w", err)
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding build state: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("writing build state: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+func statePath(outDir string) string {
+	return filepath.Join(outDir, stateDir, stateFile)
+}
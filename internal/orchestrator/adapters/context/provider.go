@@ -1,25 +1,52 @@
 package context
 
 import (
+	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/73NN0/foe-hammer/internal/orchestrator/domain"
 )
 
-type EnvProvider struct{}
+// ToolchainFinder returns the toolchain of a target, nil when there is none
+type ToolchainFinder interface {
+	Find(target domain.Target) *domain.Toolchain
+}
+
+type EnvProvider struct {
+	toolchains ToolchainFinder
+	keepEnv    []string
+}
 
 func NewEnvProvider() *EnvProvider {
 	return &EnvProvider{}
 }
 
-// module can't be null or hasn't have a name the module loader must garanty it
-func (p *EnvProvider) BuildEnv(host domain.Host, target domain.Target, module *domain.Module, outDir string) map[string]string {
+// SetToolchains injects the toolchain of the target (FOE_CC, FOE_SYSROOT...) in every env
+func (p *EnvProvider) SetToolchains(toolchains ToolchainFinder) {
+	p.toolchains = toolchains
+}
 
-	return map[string]string{
+// SetKeepEnv passes these variables of the environment of foe to every hook,
+// on top of the ones of the module (keepenv=()).
+func (p *EnvProvider) SetKeepEnv(names []string) {
+	p.keepEnv = names
+}
+
+// module can't be null or hasn't have a name the module loader must garanty it
+func (p *EnvProvider) BuildEnv(host domain.Host, target domain.Target, module *domain.Module, outDir string, deps []*domain.Module) map[string]string {
+	env := map[string]string{
 		"FOE_HOST_OS":     host.OS,
 		"FOE_HOST_ARCH":   host.Arch,
 		"FOE_TARGET_OS":   target.OS,
 		"FOE_TARGET_ARCH": target.Arch,
+
+		"FOE_HOST_TRIPLE":     host.Triple(),
+		"FOE_HOST_GNU_ARCH":   host.Target().GNUArch(),
+		"FOE_TARGET_TRIPLE":   target.Triple(),
+		"FOE_TARGET_GNU_ARCH": target.GNUArch(),
+
 		"FOE_OUTDIR":      outDir,
 		"FOE_LIBDIR":      filepath.Join(outDir, "lib"),
 		"FOE_BINDIR":      filepath.Join(outDir, "bin"),
@@ -27,4 +54,105 @@ func (p *EnvProvider) BuildEnv(host domain.Host, target domain.Target, module *d
 		"FOE_SRCDIR":      module.DirPath,
 		"FOE_MODULE_NAME": module.Name,
 	}
+
+	// kept variables are part of the env, so changing them rebuilds the module
+	for _, names := range [][]string{p.keepEnv, module.KeepEnv} {
+		for _, name := range names {
+			if strings.HasPrefix(name, "FOE_") {
+				continue
+			}
+			if v, ok := os.LookupEnv(name); ok {
+				env[name] = v
+			}
+		}
+	}
+
+	if p.toolchains != nil {
+		if tc := p.toolchains.Find(target); tc != nil {
+			addToolchain(env, tc)
+		}
+	}
+
+	addProduces(env, outDir, deps)
+	addExports(env, deps)
+
+	return env
+}
+
+// addProduces gives the absolute paths of what the deps produce, by dep (FOE_DEP_LIBA_PRODUCES)
+// and all together in build order (FOE_DEPS_ARTIFACTS).
+// outDir is the one of the module, noarch produces are linked into it.
+func addProduces(env map[string]string, outDir string, deps []*domain.Module) {
+	var all []string
+	for _, dep := range deps {
+		paths := make([]string, len(dep.Produces))
+		for i, produce := range dep.Produces {
+			paths[i] = filepath.Join(outDir, produce)
+		}
+		env["FOE_DEP_"+envName(dep.Name)+"_PRODUCES"] = strings.Join(paths, " ")
+		all = append(all, paths...)
+	}
+	if len(deps) > 0 {
+		env["FOE_DEPS_ARTIFACTS"] = strings.Join(all, " ")
+	}
+}
+
+// addExports gives the exports() of every dep twice:
+//   - by dep, FOE_DEP_LIBB_INCDIR
+//   - aggregated, FOE_DEPS_CFLAGS, dependents before their depends (-lb -la)
+//
+// An export can't replace a variable set by foe.
+func addExports(env map[string]string, deps []*domain.Module) {
+	aggregated := make(map[string][]string)
+	for i := len(deps) - 1; i >= 0; i-- {
+		dep := deps[i]
+		for k, v := range dep.Exports {
+			setIfUnset(env, "FOE_DEP_"+envName(dep.Name)+"_"+k, v)
+			if v != "" && !slices.Contains(aggregated[k], v) {
+				aggregated[k] = append(aggregated[k], v)
+			}
+		}
+	}
+	for k, values := range aggregated {
+		setIfUnset(env, "FOE_DEPS_"+k, strings.Join(values, " "))
+	}
+}
+
+func setIfUnset(env map[string]string, k, v string) {
+	if _, ok := env[k]; !ok {
+		env[k] = v
+	}
+}
+
+// envName turns a module name into a variable name part, lib-foo.2 => LIB_FOO_2
+func envName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// addToolchain adds the variables the toolchain sets, FOE_TOOLCHAIN names it
+func addToolchain(env map[string]string, tc *domain.Toolchain) {
+	vars := map[string]string{
+		"FOE_TOOLCHAIN": tc.Name,
+		"FOE_CC":        tc.CC,
+		"FOE_CXX":       tc.CXX,
+		"FOE_AR":        tc.AR,
+		"FOE_LD":        tc.LD,
+		"FOE_SYSROOT":   tc.Sysroot,
+		"FOE_CFLAGS":    tc.CFlags,
+		"FOE_CXXFLAGS":  tc.CXXFlags,
+		"FOE_LDFLAGS":   tc.LDFlags,
+	}
+	for k, v := range vars {
+		if v != "" {
+			env[k] = v
+		}
+	}
 }
@@ -18,22 +18,27 @@ func TestBuildEnv(t *testing.T) {
 		DirPath: "src/libb",
 	}
 
-	env := context.NewEnvProvider().BuildEnv(host, target, mod, outDir)
+	env := context.NewEnvProvider().BuildEnv(host, target, mod, outDir, nil)
 	want := map[string]string{
-		"FOE_HOST_OS":     "linux",
-		"FOE_HOST_ARCH":   "amd64",
-		"FOE_TARGET_OS":   "linux",
-		"FOE_TARGET_ARCH": "amd64",
-		"FOE_OUTDIR":      outDir,
-		"FOE_LIBDIR":      filepath.Join(outDir, "lib"),
-		"FOE_BINDIR":      filepath.Join(outDir, "bin"),
-		"FOE_OBJDIR":      filepath.Join(outDir, "obj", mod.Name),
-		"FOE_SRCDIR":      mod.DirPath,
-		"FOE_MODULE_NAME": mod.Name,
+		"FOE_HOST_OS":         "linux",
+		"FOE_HOST_ARCH":       "amd64",
+		"FOE_TARGET_OS":       "linux",
+		"FOE_TARGET_ARCH":     "amd64",
+		"FOE_HOST_TRIPLE":     "x86_64-linux-gnu",
+		"FOE_HOST_GNU_ARCH":   "x86_64",
+		"FOE_TARGET_TRIPLE":   "x86_64-linux-gnu",
+		"FOE_TARGET_GNU_ARCH": "x86_64",
+		"FOE_OUTDIR":          outDir,
+		"FOE_LIBDIR":          filepath.Join(outDir, "lib"),
+		"FOE_BINDIR":          filepath.Join(outDir, "bin"),
+		"FOE_OBJDIR":          filepath.Join(outDir, "obj", mod.Name),
+		"FOE_SRCDIR":          mod.DirPath,
+		"FOE_MODULE_NAME":     mod.Name,
 	}
 
 	required := []string{
 		"FOE_HOST_OS", "FOE_HOST_ARCH", "FOE_TARGET_OS", "FOE_TARGET_ARCH",
+		"FOE_HOST_TRIPLE", "FOE_TARGET_TRIPLE", "FOE_HOST_GNU_ARCH", "FOE_TARGET_GNU_ARCH",
 		"FOE_OUTDIR", "FOE_LIBDIR", "FOE_BINDIR", "FOE_OBJDIR", "FOE_SRCDIR", "FOE_MODULE_NAME",
 	}
 	for _, k := range required {
@@ -57,3 +62,110 @@ func TestBuildEnv(t *testing.T) {
 		t.Fatalf("env has extra/missing keys: got %d keys, want %d keys", len(env), len(want))
 	}
 }
+
+type fixedToolchain struct{ tc *domain.Toolchain }
+
+func (f fixedToolchain) Find(target domain.Target) *domain.Toolchain { return f.tc }
+
+func TestBuildEnvToolchain(t *testing.T) {
+	provider := context.NewEnvProvider()
+	provider.SetToolchains(fixedToolchain{&domain.Toolchain{
+		Name:    "linux-arm64",
+		CC:      "aarch64-linux-gnu-gcc",
+		Sysroot: "/opt/sysroots/arm64",
+	}})
+
+	env := provider.BuildEnv(domain.NewHost(), domain.Target{OS: "linux", Arch: "arm64"}, &domain.Module{Name: "liba"}, "/tmp/foe-out", nil)
+	want := map[string]string{
+		"FOE_TOOLCHAIN": "linux-arm64",
+		"FOE_CC":        "aarch64-linux-gnu-gcc",
+		"FOE_SYSROOT":   "/opt/sysroots/arm64",
+	}
+	for k, v := range want {
+		if env[k] != v {
+			t.Errorf("key %q: got %q, want %q", k, env[k], v)
+		}
+	}
+
+	// unset fields are not injected, hooks can use ${FOE_CXX:-c++}
+	if _, ok := env["FOE_CXX"]; ok {
+		t.Errorf("FOE_CXX should not be set, got %q", env["FOE_CXX"])
+	}
+}
+
+func TestBuildEnvKeepEnv(t *testing.T) {
+	t.Setenv("CCACHE_DIR", "/tmp/ccache")
+	t.Setenv("SOURCE_DATE_EPOCH", "0")
+	t.Setenv("CFLAGS", "-O0")
+	t.Setenv("FOE_OUTDIR", "/elsewhere")
+
+	provider := context.NewEnvProvider()
+	provider.SetKeepEnv([]string{"SOURCE_DATE_EPOCH", "NOT_SET"})
+
+	mod := &domain.Module{Name: "liba", KeepEnv: []string{"CCACHE_DIR", "FOE_OUTDIR"}}
+	env := provider.BuildEnv(domain.NewHost(), domain.NewTarget(), mod, "/tmp/foe-out", nil)
+
+	for k, v := range map[string]string{
+		"CCACHE_DIR":        "/tmp/ccache",  // keepenv=()
+		"SOURCE_DATE_EPOCH": "0",            // project keep_env
+		"FOE_OUTDIR":        "/tmp/foe-out", // FOE_* can't be overridden
+	} {
+		if env[k] != v {
+			t.Errorf("key %q: got %q, want %q", k, env[k], v)
+		}
+	}
+	for _, k := range []string{"CFLAGS", "NOT_SET"} {
+		if _, ok := env[k]; ok {
+			t.Errorf("%s should not be kept", k)
+		}
+	}
+}
+
+func TestBuildEnvExports(t *testing.T) {
+	// build order: liba, then libb depending on it
+	deps := []*domain.Module{
+		{Name: "liba", Exports: map[string]string{"INCDIR": "/src/liba", "LIBS": "-la", "CFLAGS": "-DA"}},
+		{Name: "lib-b", Exports: map[string]string{"INCDIR": "/src/libb", "LIBS": "-lb", "CFLAGS": "-DA"}},
+		{Name: "plain"},
+	}
+
+	env := context.NewEnvProvider().BuildEnv(domain.NewHost(), domain.NewTarget(), &domain.Module{Name: "app"}, "/tmp/foe-out", deps)
+	for k, v := range map[string]string{
+		"FOE_DEP_LIBA_INCDIR":  "/src/liba",
+		"FOE_DEP_LIB_B_INCDIR": "/src/libb",
+		"FOE_DEP_LIB_B_LIBS":   "-lb",
+		"FOE_DEPS_LIBS":        "-lb -la", // dependents first, for the linker
+		"FOE_DEPS_INCDIR":      "/src/libb /src/liba",
+		"FOE_DEPS_CFLAGS":      "-DA", // once
+	} {
+		if env[k] != v {
+			t.Errorf("key %q: got %q, want %q", k, env[k], v)
+		}
+	}
+}
+
+func TestBuildEnvProduces(t *testing.T) {
+	deps := []*domain.Module{
+		{Name: "liba", Produces: []string{"lib/liba.a"}},
+		{Name: "libb", Produces: []string{"lib/libb.a", "include/b.h"}},
+		{Name: "data"},
+	}
+
+	env := context.NewEnvProvider().BuildEnv(domain.NewHost(), domain.NewTarget(), &domain.Module{Name: "app"}, "/tmp/foe-out", deps)
+	for k, v := range map[string]string{
+		"FOE_DEP_LIBA_PRODUCES": "/tmp/foe-out/lib/liba.a",
+		"FOE_DEP_LIBB_PRODUCES": "/tmp/foe-out/lib/libb.a /tmp/foe-out/include/b.h",
+		"FOE_DEP_DATA_PRODUCES": "",
+		"FOE_DEPS_ARTIFACTS":    "/tmp/foe-out/lib/liba.a /tmp/foe-out/lib/libb.a /tmp/foe-out/include/b.h",
+	} {
+		if got, ok := env[k]; !ok || got != v {
+			t.Errorf("key %q: got %q, want %q", k, got, v)
+		}
+	}
+
+	// no depends, no variable
+	env = context.NewEnvProvider().BuildEnv(domain.NewHost(), domain.NewTarget(), &domain.Module{Name: "liba"}, "/tmp/foe-out", nil)
+	if _, ok := env["FOE_DEPS_ARTIFACTS"]; ok {
+		t.Error("FOE_DEPS_ARTIFACTS should not be set without depends")
+	}
+}
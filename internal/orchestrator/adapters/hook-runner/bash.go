@@ -2,43 +2,77 @@ package hookrunner
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"regexp"
+	"slices"
 	"strings"
 
+	bashpool "github.com/73NN0/foe-hammer/internal/orchestrator/adapters/bash-pool"
 	"github.com/73NN0/foe-hammer/internal/orchestrator/domain"
 )
 
-type BashHookRunner struct{}
+var ErrInvalidExport = errors.New("invalid exports() output")
+
+// baseEnv is what hooks get from the environment of foe in hermetic mode,
+// besides the env given by the orchestrator (FOE_*, keepenv=()...)
+var baseEnv = []string{"PATH", "HOME", "USER", "LOGNAME", "SHELL", "TMPDIR", "TERM"}
+
+// BashHookRunner runs hooks in a hermetic environment by default, see SetInheritEnv
+// produces() and exports() run in the subshells of long-lived bash processes, see bashpool
+type BashHookRunner struct {
+	inheritEnv bool
+	sandbox    bool
+	pool       *bashpool.Pool
+}
 
 func NewBashHookRunner() *BashHookRunner {
-	return &BashHookRunner{}
+	return &BashHookRunner{pool: bashpool.New(0)}
 }
 
-func (r *BashHookRunner) Run(module *domain.Module, env map[string]string) error {
-	script := fmt.Sprintf(`source "%s" && build`, module.Path)
+// SetInheritEnv gives hooks the whole environment of foe (CFLAGS, LANG...),
+// builds then depend on the shell they are started from.
+func (r *BashHookRunner) SetInheritEnv(inherit bool) {
+	r.inheritEnv = inherit
+}
 
-	cmd := createCmd(script, module.DirPath, os.Stdout)
-	injectEnvv(cmd, env)
-	return execute(cmd)
+// SetSandbox runs hooks with the source tree read-only, $FOE_OUTDIR being the only
+// writable place, without network and with a private /tmp. Linux only, see sandbox.go
+func (r *BashHookRunner) SetSandbox(sandbox bool) {
+	r.sandbox = sandbox
 }
 
-func (r *BashHookRunner) Produces(module *domain.Module, env map[string]string) ([]string, error) {
-	script := fmt.Sprintf(`source "%s" && produces`, module.Path)
+// SetPool shares pool with other adapters, e.g. the module loader
+func (r *BashHookRunner) SetPool(pool *bashpool.Pool) {
+	r.pool = pool
+}
+
+// Close stops the bash workers
+func (r *BashHookRunner) Close() error {
+	return r.pool.Close()
+}
 
-	var stdout bytes.Buffer
-	cmd := createCmd(script, module.DirPath, &stdout)
-	injectEnvv(cmd, env)
+func (r *BashHookRunner) Run(ctx context.Context, module *domain.Module, env map[string]string) error {
+	cmd, err := r.command(ctx, module, "build", env, os.Stdout)
+	if err != nil {
+		return err
+	}
+	return r.run(cmd, env)
+}
 
-	if err := execute(cmd); err != nil {
+func (r *BashHookRunner) Produces(ctx context.Context, module *domain.Module, env map[string]string) ([]string, error) {
+	stdout, err := r.output(ctx, module, "produces", env)
+	if err != nil {
 		return nil, err
 	}
 
 	// Parse output : une ligne = un produce
 	var produces []string
-	for _, line := range strings.Split(strings.TrimSpace(stdout.String()), "\n") {
+	for _, line := range strings.Split(strings.TrimSpace(stdout), "\n") {
 		if line != "" {
 			produces = append(produces, line)
 		}
@@ -46,24 +80,165 @@ func (r *BashHookRunner) Produces(module *domain.Module, env map[string]string)
 	return produces, nil
 }
 
-func createCmd(script, DirPath string, stdout io.Writer) *exec.Cmd {
-	cmd := exec.Command("bash", "-c", script)
+// Exports runs exports(), one KEY=VALUE per line, blank lines and # comments are ignored
+func (r *BashHookRunner) Exports(ctx context.Context, module *domain.Module, env map[string]string) (map[string]string, error) {
+	stdout, err := r.output(ctx, module, "exports", env)
+	if err != nil {
+		return nil, err
+	}
+	return parseExports(stdout)
+}
+
+// output runs a hook printing what it declares, in the pool unless sandboxed
+func (r *BashHookRunner) output(ctx context.Context, module *domain.Module, hook string, env map[string]string) (string, error) {
+	if r.sandbox {
+		var stdout bytes.Buffer
+		cmd, err := r.command(ctx, module, hook, env, &stdout)
+		if err != nil {
+			return "", err
+		}
+		if err := r.run(cmd, env); err != nil {
+			return "", err
+		}
+		return stdout.String(), nil
+	}
+
+	script := fmt.Sprintf(`source "%s" && %s`, module.Path, hook)
+	res, err := r.pool.Run(ctx, module.DirPath, script, r.envv(env))
+	if err != nil {
+		return "", fmt.Errorf("executing %s: %w", hook, err)
+	}
+	if res.Stderr != "" {
+		fmt.Fprintln(os.Stderr, res.Stderr)
+	}
+	if res.ExitCode != 0 {
+		return "", fmt.Errorf("executing %s: exit status %d", hook, res.ExitCode)
+	}
+	return res.Stdout, nil
+}
+
+var exportKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func parseExports(output string) (map[string]string, error) {
+	exports := make(map[string]string)
+	for i, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || !exportKey.MatchString(key) {
+			return nil, fmt.Errorf("%w: line %d: %q, expected KEY=VALUE", ErrInvalidExport, i+1, line)
+		}
+		exports[key] = value
+	}
+	return exports, nil
+}
+
+// command sources the PKGBUILD and calls hook, in the sandbox if enabled
+func (r *BashHookRunner) command(ctx context.Context, module *domain.Module, hook string, env map[string]string, stdout io.Writer) (*exec.Cmd, error) {
+	script := fmt.Sprintf(`source "%s" && %s`, module.Path, hook)
+	if r.sandbox {
+		// bound onto itself by the sandbox, it has to exist
+		if err := os.MkdirAll(env["FOE_OUTDIR"], 0755); err != nil {
+			return nil, err
+		}
+		script = sandboxScript(env) + script
+	}
+
+	cmd := createCmd(ctx, script, module.DirPath, stdout)
+	r.injectEnvv(cmd, env)
+	if r.sandbox {
+		// after createCmd, the process group settings are kept
+		if err := sandbox(cmd); err != nil {
+			return nil, err
+		}
+	}
+	return cmd, nil
+}
+
+// run executes cmd, a sandboxed hook failing on a read-only path is a violation
+func (r *BashHookRunner) run(cmd *exec.Cmd, env map[string]string) error {
+	if !r.sandbox {
+		return execute(cmd)
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = io.MultiWriter(cmd.Stderr, &stderr)
+	err := execute(cmd)
+	if err == nil {
+		return nil
+	}
+	// the hook didn't even run, the tree would have been writable
+	if mnt := sandboxSetupFailure(stderr.String()); mnt != "" {
+		return fmt.Errorf("%w: %s can't be made read-only", ErrSandboxSetup, mnt)
+	}
+	if paths := sandboxViolations(stderr.String()); len(paths) > 0 {
+		return fmt.Errorf("%w (%s): %s", ErrSandboxViolation, env["FOE_OUTDIR"], strings.Join(paths, ", "))
+	}
+	return err
+}
+
+// createCmd runs the hook in its own process group,
+// so cancelling ctx stops bash and everything it spawned, see setProcessGroup.
+func createCmd(ctx context.Context, script, DirPath string, stdout io.Writer) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "bash", "-c", script)
 	cmd.Dir = DirPath
 	cmd.Stdout = stdout
 	cmd.Stderr = os.Stderr
+	setProcessGroup(cmd)
 	return cmd
 }
 
-func injectEnvv(cmd *exec.Cmd, env map[string]string) {
+func (r *BashHookRunner) injectEnvv(cmd *exec.Cmd, env map[string]string) {
+	cmd.Env = r.envv(env)
+}
+
+// envv returns the whole environment of a hook
+func (r *BashHookRunner) envv(env map[string]string) []string {
+	var envv []string
+	if r.inheritEnv {
+		envv = os.Environ()
+	} else {
+		// same messages and sorting on every machine, keepenv=(LANG) to change it
+		envv = []string{"LANG=C"}
+		for _, k := range baseEnv {
+			if v, ok := os.LookupEnv(k); ok {
+				envv = append(envv, k+"="+v)
+			}
+		}
+	}
 
-	cmd.Env = os.Environ()
 	for k, v := range env {
-		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
+		envv = append(envv, fmt.Sprintf("%s=%s", k, v))
+	}
+
+	// host tools (hostdepends=()) are found first, before the PATH hooks would get otherwise
+	if bindir, ok := env["FOE_HOST_BINDIR"]; ok {
+		path := bindir
+		if p := lookupEnvv(envv, "PATH"); p != "" {
+			path += string(os.PathListSeparator) + p
+		}
+		envv = append(envv, "PATH="+path)
+	}
+	return envv
+}
+
+// lookupEnvv returns the value of key in envv, the last one wins like for exec
+func lookupEnvv(envv []string, key string) string {
+	for _, kv := range slices.Backward(envv) {
+		if v, ok := strings.CutPrefix(kv, key+"="); ok {
+			return v
+		}
 	}
+	return ""
 }
 
 func execute(cmd *exec.Cmd) error {
-	if err := cmd.Run(); err != nil {
+	err := cmd.Run()
+	// bash may be gone while its children still run, e.g. `cc ... &`
+	killProcessGroup(cmd)
+	if err != nil {
 		return fmt.Errorf("executing %s: %w", cmd.Args, err)
 	}
 	return nil
@@ -0,0 +1,144 @@
+//go:build unix
+
+package hookrunner_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	hookrunner "github.com/73NN0/foe-hammer/internal/orchestrator/adapters/hook-runner"
+	"github.com/73NN0/foe-hammer/internal/orchestrator/domain"
+)
+
+// cancelling a hook must also stop the processes it started in background
+func TestRunCancelKillsProcessGroup(t *testing.T) {
+	dir := t.TempDir()
+	pidFile := filepath.Join(dir, "child.pid")
+
+	pkgbuild := `build() {
+    sleep 30 &
+    echo $! > "` + pidFile + `"
+    wait
+}
+`
+	path := filepath.Join(dir, "PKGBUILD")
+	if err := os.WriteFile(path, []byte(pkgbuild), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := &domain.Module{Name: "hang", Path: path, DirPath: dir}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	err := hookrunner.NewBashHookRunner().Run(ctx, m, nil)
+	if err == nil {
+		t.Fatal("expected an error from a cancelled hook, got nil")
+	}
+
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatalf("reading child pid: %v", err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the child may need a moment to be reaped by init
+	deadline := time.Now().Add(2 * time.Second)
+	for syscall.Kill(pid, 0) == nil {
+		if time.Now().After(deadline) {
+			syscall.Kill(pid, syscall.SIGKILL)
+			t.Fatalf("background child %d survived the cancellation", pid)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestRunHermeticEnv(t *testing.T) {
+	t.Setenv("CFLAGS", "-O0 -from-my-shell")
+	t.Setenv("CCACHE_DIR", "/tmp/ccache")
+
+	dir := t.TempDir()
+	envFile := filepath.Join(dir, "env")
+	pkgbuild := `build() {
+    env > "` + envFile + `"
+}
+`
+	path := filepath.Join(dir, "PKGBUILD")
+	if err := os.WriteFile(path, []byte(pkgbuild), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := &domain.Module{Name: "env", Path: path, DirPath: dir}
+	env := map[string]string{"FOE_MODULE_NAME": "env", "CCACHE_DIR": "/tmp/ccache"}
+
+	tests := []struct {
+		name    string
+		inherit bool
+		env     map[string]string // env when set
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "hermetic",
+			want:    []string{"FOE_MODULE_NAME=env", "CCACHE_DIR=/tmp/ccache", "LANG=C", "PATH="},
+			notWant: []string{"CFLAGS="},
+		},
+		{
+			name:    "inherit",
+			inherit: true,
+			want:    []string{"FOE_MODULE_NAME=env", "CFLAGS=-O0 -from-my-shell"},
+		},
+		{
+			// e.g. keepenv=(PATH) or a toolchain, not the PATH of foe
+			name: "host bindir before the PATH given",
+			env:  map[string]string{"PATH": "/opt/tc/bin:/usr/bin:/bin", "FOE_HOST_BINDIR": "/out/host/bin"},
+			want: []string{"PATH=/out/host/bin:/opt/tc/bin:/usr/bin:/bin"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := hookrunner.NewBashHookRunner()
+			runner.SetInheritEnv(tt.inherit)
+			hookEnv := env
+			if tt.env != nil {
+				hookEnv = tt.env
+			}
+			if err := runner.Run(context.Background(), m, hookEnv); err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+
+			data, err := os.ReadFile(envFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := strings.Split(string(data), "\n")
+			has := func(prefix string) bool {
+				for _, line := range lines {
+					if strings.HasPrefix(line, prefix) {
+						return true
+					}
+				}
+				return false
+			}
+
+			for _, w := range tt.want {
+				if !has(w) {
+					t.Errorf("expected %s in the hook env", w)
+				}
+			}
+			for _, w := range tt.notWant {
+				if has(w) {
+					t.Errorf("%s leaked into the hook env", w)
+				}
+			}
+		})
+	}
+}
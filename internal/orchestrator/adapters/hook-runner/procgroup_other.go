@@ -0,0 +1,17 @@
+//go:build !unix
+
+package hookrunner
+
+import (
+	"os/exec"
+	"time"
+)
+
+const killGrace = 5 * time.Second
+
+// no process groups here, only bash itself is killed on cancellation
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.WaitDelay = killGrace
+}
+
+func killProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,32 @@
+//go:build unix
+
+package hookrunner
+
+import (
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// killGrace is how long a cancelled hook has to exit after SIGTERM before SIGKILL
+const killGrace = 5 * time.Second
+
+// setProcessGroup puts the hook in a new process group.
+// On cancellation SIGTERM is sent to the whole group, not only to bash,
+// so compilers started by build() don't outlive foe.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+	}
+	cmd.WaitDelay = killGrace
+}
+
+// killProcessGroup kills what is left of the group once bash has exited
+func killProcessGroup(cmd *exec.Cmd) {
+	if cmd.Process == nil {
+		return
+	}
+	// ESRCH when the group is already empty, nothing to do
+	_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
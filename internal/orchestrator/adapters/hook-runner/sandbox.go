@@ -0,0 +1,126 @@
+package hookrunner
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var (
+	ErrSandboxUnsupported = errors.New("sandbox is only supported on Linux")
+	ErrSandboxViolation   = errors.New("hook wrote outside of $FOE_OUTDIR")
+	ErrSandboxSetup       = errors.New("sandbox could not be set up")
+)
+
+// sandboxTmp is replaced by an empty tmpfs in the sandbox
+const sandboxTmp = "/tmp"
+
+// sandboxScript prepares the mount namespace before the hook runs, as root of its user namespace:
+//   - $FOE_OUTDIR stays writable, every other mount is remounted read-only,
+//     the hook doesn't run when one can't be (see sandboxSetupFailure)
+//   - /tmp is a private tmpfs, the FOE_* dirs living in the real /tmp are bound back into it
+//
+// Needs mount(8) from util-linux for --no-canonicalize: the dirs of the real /tmp
+// are only reachable through fds once the tmpfs hides them.
+func sandboxScript(env map[string]string) string {
+	var b strings.Builder
+	b.WriteString("set -e\n")
+
+	out := env["FOE_OUTDIR"]
+	if out != "" {
+		b.WriteString(`mount --bind "$FOE_OUTDIR" "$FOE_OUTDIR"` + "\n")
+	}
+
+	// open them once $FOE_OUTDIR is bound, so its fd is on the writable mount
+	carried := carriedDirs(env)
+	for i, dir := range carried {
+		fmt.Fprintf(&b, "exec %d<%s\n", i+3, shellQuote(dir))
+	}
+
+	// \040 for a space in /proc/self/mounts, and the flags locked in a user namespace
+	// (nosuid, nodev...) must be kept or the kernel refuses the remount
+	b.WriteString(`while read -r _ __foe_mnt _ __foe_opts _; do
+	__foe_mnt=$(printf '%b' "$__foe_mnt")
+	case "$__foe_mnt" in "$FOE_OUTDIR"|/proc|/proc/*|/sys|/sys/*|/dev|/dev/*) continue ;; esac
+	case ",$__foe_opts," in *,ro,*) continue ;; esac
+	__foe_flags=remount,bind,ro
+	for __foe_o in nosuid nodev noexec noatime nodiratime relatime strictatime; do
+		case ",$__foe_opts," in *,$__foe_o,*) __foe_flags=$__foe_flags,$__foe_o ;; esac
+	done
+	mount -o "$__foe_flags" "$__foe_mnt" || { echo "` + sandboxNotReadOnly + `$__foe_mnt" >&2; exit 1; }
+done < /proc/self/mounts
+mount -t tmpfs tmpfs ` + sandboxTmp + "\n")
+
+	for i, dir := range carried {
+		fmt.Fprintf(&b, "mkdir -p %[2]s && mount --no-canonicalize --bind /proc/self/fd/%[1]d %[2]s && exec %[1]d<&-\n", i+3, shellQuote(dir))
+	}
+
+	b.WriteString("export TMPDIR=" + sandboxTmp + "\nunset __foe_mnt __foe_opts __foe_flags __foe_o\nset +e\n")
+	return b.String()
+}
+
+// sandboxNotReadOnly starts the line sandboxScript prints before giving up on a mount
+const sandboxNotReadOnly = "foe-sandbox: cannot remount read-only: "
+
+// sandboxSetupFailure returns the mount sandboxScript couldn't make read-only, "" if none
+func sandboxSetupFailure(stderr string) string {
+	for _, line := range strings.Split(stderr, "\n") {
+		if mnt, ok := strings.CutPrefix(line, sandboxNotReadOnly); ok {
+			return mnt
+		}
+	}
+	return ""
+}
+
+// carriedDirs returns the FOE_* dirs inside /tmp, without the ones inside another one
+func carriedDirs(env map[string]string) []string {
+	var dirs []string
+	for k, v := range env {
+		if strings.HasPrefix(k, "FOE_") && filepath.IsAbs(v) && isInside(v, sandboxTmp) && isDir(v) {
+			dirs = append(dirs, filepath.Clean(v))
+		}
+	}
+	slices.Sort(dirs)
+
+	var top []string
+	for _, dir := range dirs {
+		if len(top) > 0 && isInside(dir, top[len(top)-1]) {
+			continue
+		}
+		top = append(top, dir)
+	}
+	return top
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+func isInside(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, "../")
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// cannot touch '/src/x.o': Read-only file system
+// bash: line 1: /src/x.o: Read-only file system
+var readOnlyPath = regexp.MustCompile(`(/[^\s'":]*)'?: Read-only file system`)
+
+// sandboxViolations returns the paths a sandboxed hook failed to write, from its stderr
+func sandboxViolations(stderr string) []string {
+	var paths []string
+	for _, match := range readOnlyPath.FindAllStringSubmatch(stderr, -1) {
+		if !slices.Contains(paths, match[1]) {
+			paths = append(paths, match[1])
+		}
+	}
+	return paths
+}
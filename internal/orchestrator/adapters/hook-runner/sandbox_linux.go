@@ -0,0 +1,23 @@
+//go:build linux
+
+package hookrunner
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// sandbox runs cmd in new user, mount and network namespaces,
+// as root of the user namespace so sandboxScript can mount.
+// Files written in $FOE_OUTDIR still belong to the user running foe.
+func sandbox(cmd *exec.Cmd) error {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Cloneflags = syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWNET
+	cmd.SysProcAttr.UidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}}
+	cmd.SysProcAttr.GidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}}
+	cmd.SysProcAttr.GidMappingsEnableSetgroups = false
+	return nil
+}
@@ -0,0 +1,99 @@
+//go:build linux
+
+package hookrunner_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	hookrunner "github.com/73NN0/foe-hammer/internal/orchestrator/adapters/hook-runner"
+	"github.com/73NN0/foe-hammer/internal/orchestrator/domain"
+)
+
+func TestRunSandbox(t *testing.T) {
+	runner := hookrunner.NewBashHookRunner()
+	runner.SetSandbox(true)
+
+	// some CI forbid unprivileged user namespaces
+	probe := sandboxModule(t, `build() { :; }`)
+	if err := runner.Run(context.Background(), probe, sandboxEnv(probe)); err != nil {
+		t.Skipf("sandbox unavailable here: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		build   string
+		wantErr string // "" means success, a path means a violation on it
+	}{
+		{
+			name:  "writes FOE_OUTDIR",
+			build: `build() { mkdir -p "$FOE_LIBDIR" && echo ok > "$FOE_LIBDIR/lib.a"; }`,
+		},
+		{
+			name:    "writes FOE_SRCDIR",
+			build:   `build() { echo bad > "$FOE_SRCDIR/generated.c"; }`,
+			wantErr: "generated.c",
+		},
+		{
+			name:  "private tmp",
+			build: `build() { echo tmp > /tmp/foe-sandbox-test && test "$TMPDIR" = /tmp; }`,
+		},
+		{
+			// a new network namespace only has lo
+			name:  "no network",
+			build: `build() { test "$(grep -c : /proc/net/dev)" = 1; }`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := sandboxModule(t, tt.build)
+			env := sandboxEnv(m)
+
+			err := runner.Run(context.Background(), m, env)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Run() error = %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, hookrunner.ErrSandboxViolation) {
+				t.Fatalf("Run() error = %v, want ErrSandboxViolation", err)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Run() error = %v, want it to name %s", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := os.Stat("/tmp/foe-sandbox-test"); err == nil {
+		os.Remove("/tmp/foe-sandbox-test")
+		t.Error("a file written in the sandbox /tmp is visible outside")
+	}
+}
+
+func sandboxModule(t *testing.T, build string) *domain.Module {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "src", "PKGBUILD")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(build+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return &domain.Module{Name: "sandboxed", Path: path, DirPath: filepath.Dir(path)}
+}
+
+func sandboxEnv(m *domain.Module) map[string]string {
+	out := filepath.Join(filepath.Dir(m.DirPath), "out")
+	return map[string]string{
+		"FOE_SRCDIR": m.DirPath,
+		"FOE_OUTDIR": out,
+		"FOE_LIBDIR": filepath.Join(out, "lib"),
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package hookrunner
+
+import (
+	"os/exec"
+)
+
+func sandbox(cmd *exec.Cmd) error {
+	return ErrSandboxUnsupported
+}
@@ -3,13 +3,17 @@ package moduleloader
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io/fs"
-	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	bashpool "github.com/73NN0/foe-hammer/internal/orchestrator/adapters/bash-pool"
 	"github.com/73NN0/foe-hammer/internal/orchestrator/domain"
 )
 
@@ -18,26 +22,72 @@ const (
 	tagDesc = "DESC:"
 	tagDeps = "DEPS:"
 	tagMake = "MAKE:"
+	tagHost = "HOST:"
 	tagSrcs = "SRCS:"
+	tagTime = "TIME:"
+	tagProv = "PROV:"
+	tagConf = "CONF:"
+	tagArch = "ARCH:"
+	tagOS   = "OS:"
+	tagKeep = "KEEP:"
+	tagHook = "HOOK:" // optional hooks defined
+	tagMiss = "MISS:" // required hooks not defined
+	tagCond = "COND:" // target-conditional arrays: COND:depends_linux=a b
 )
 
 var (
 	ErrModuleLoaderNoLoadingModule error = errors.New("Loading module")
 )
 
+var (
+	requiredHooks = []string{"produces", "build"}
+	optionalHooks = []string{"exports"}
+)
+
 func buildScript(path string) string {
 	return `source "` + path + `"
 printf '` + tagName + `%s\n' "$pkgname"
 printf '` + tagDesc + `%s\n' "$pkgdesc"
 printf '` + tagDeps + `%s\n' "${depends[*]}"
 printf '` + tagMake + `%s\n' "${makedepends[*]}"
-printf '` + tagSrcs + `%s\n' "${source[*]}"`
+printf '` + tagHost + `%s\n' "${hostdepends[*]}"
+printf '` + tagSrcs + `%s\n' "${source[*]}"
+printf '` + tagTime + `%s\n' "$timeout"
+printf '` + tagProv + `%s\n' "${provides[*]}"
+printf '` + tagConf + `%s\n' "${conflicts[*]}"
+printf '` + tagArch + `%s\n' "${arch[*]}"
+printf '` + tagOS + `%s\n' "${os[*]}"
+printf '` + tagKeep + `%s\n' "${keepenv[*]}"
+for __h in ` + strings.Join(optionalHooks, " ") + `; do
+	type -t "$__h" &>/dev/null && printf '` + tagHook + `%s\n' "$__h"
+done
+for __h in ` + strings.Join(requiredHooks, " ") + `; do
+	type -t "$__h" &>/dev/null || printf '` + tagMiss + `%s\n' "$__h"
+done
+for __v in $(compgen -A variable depends_) $(compgen -A variable makedepends_) $(compgen -A variable source_); do
+	eval "__a=(\"\${${__v}[@]}\")" # no nameref, macOS still ships bash 3
+	printf '` + tagCond + `%s=%s\n' "$__v" "${__a[*]}"
+done`
 }
 
-type BashLoader struct{}
+// BashLoader sources PKGBUILDs in bash, many at once in the subshells of a few
+// long-lived bash processes, see bashpool
+type BashLoader struct {
+	pool *bashpool.Pool
+}
 
 func NewBashLoader() *BashLoader {
-	return &BashLoader{}
+	return &BashLoader{pool: bashpool.New(0)}
+}
+
+// SetPool shares pool with other adapters, e.g. the hook runner
+func (l *BashLoader) SetPool(pool *bashpool.Pool) {
+	l.pool = pool
+}
+
+// Close stops the bash workers
+func (l *BashLoader) Close() error {
+	return l.pool.Close()
 }
 
 func (l *BashLoader) Load(path string) (*domain.Module, error) {
@@ -45,23 +95,22 @@ func (l *BashLoader) Load(path string) (*domain.Module, error) {
 	if err != nil {
 		return nil, fmt.Errorf("resolving path %s: %w", path, err)
 	}
-	cmd := exec.Command("bash", "-c", buildScript(absPath))
-	cmd.Dir = filepath.Dir(filepath.Clean(path))
 
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("parsing %s: %w\n%s", path, err, stderr.String())
-	}
-	m, err := l.parseTagged(&stdout)
+	// metadata and hooks in one pass
+	res, err := l.pool.Run(context.Background(), filepath.Dir(absPath), buildScript(absPath), nil)
 	if err != nil {
-		return nil, err
+		return nil, &LoadError{Path: path, Msg: err.Error(), Err: err}
+	}
+	if res.ExitCode != 0 {
+		return nil, &LoadError{Path: path, Msg: fmt.Sprintf("exit status %d", res.ExitCode), Stderr: res.Stderr}
 	}
 
-	if err := validateHooks(absPath); err != nil {
-		return nil, fmt.Errorf("%s: %w", path, err)
+	m, err := l.parseTagged(bytes.NewBufferString(res.Stdout))
+	if err != nil {
+		loadErr := asLoadError(path, err)
+		// e.g. the command not found that left pkgdesc empty
+		loadErr.Stderr = res.Stderr
+		return nil, loadErr
 	}
 
 	m.DirPath = filepath.Dir(absPath)
@@ -71,6 +120,7 @@ func (l *BashLoader) Load(path string) (*domain.Module, error) {
 
 func (l *BashLoader) parseTagged(output *bytes.Buffer) (*domain.Module, error) {
 	m := &domain.Module{}
+	var missing []string
 
 	scanner := bufio.NewScanner(output)
 	for scanner.Scan() {
@@ -85,8 +135,32 @@ func (l *BashLoader) parseTagged(output *bytes.Buffer) (*domain.Module, error) {
 			m.Depends = strings.Fields(strings.TrimPrefix(line, tagDeps))
 		case strings.HasPrefix(line, tagMake):
 			m.MakeDepends = strings.Fields(strings.TrimPrefix(line, tagMake))
+		case strings.HasPrefix(line, tagHost):
+			m.HostDepends = strings.Fields(strings.TrimPrefix(line, tagHost))
 		case strings.HasPrefix(line, tagSrcs):
 			m.Sources = strings.Fields(strings.TrimPrefix(line, tagSrcs))
+		case strings.HasPrefix(line, tagProv):
+			m.Provides = strings.Fields(strings.TrimPrefix(line, tagProv))
+		case strings.HasPrefix(line, tagConf):
+			m.Conflicts = strings.Fields(strings.TrimPrefix(line, tagConf))
+		case strings.HasPrefix(line, tagArch):
+			m.Arch = strings.Fields(strings.TrimPrefix(line, tagArch))
+		case strings.HasPrefix(line, tagOS):
+			m.OS = strings.Fields(strings.TrimPrefix(line, tagOS))
+		case strings.HasPrefix(line, tagKeep):
+			m.KeepEnv = strings.Fields(strings.TrimPrefix(line, tagKeep))
+		case strings.HasPrefix(line, tagMiss):
+			missing = append(missing, strings.TrimPrefix(line, tagMiss))
+		case strings.HasPrefix(line, tagHook):
+			m.Hooks = append(m.Hooks, strings.TrimPrefix(line, tagHook))
+		case strings.HasPrefix(line, tagCond):
+			parseConditional(m, strings.TrimPrefix(line, tagCond))
+		case strings.HasPrefix(line, tagTime):
+			timeout, err := parseTimeout(strings.TrimPrefix(line, tagTime))
+			if err != nil {
+				return nil, fieldError("timeout", "%v", err)
+			}
+			m.Timeout = timeout
 		}
 	}
 
@@ -95,41 +169,67 @@ func (l *BashLoader) parseTagged(output *bytes.Buffer) (*domain.Module, error) {
 	}
 	// validation
 	if m.Name == "" {
-		return nil, fmt.Errorf("missing pkgname")
+		return nil, fieldError("pkgname", "missing pkgname")
 	}
 
 	if m.Description == "" {
-		return nil, fmt.Errorf("missing pkgdesc")
+		return nil, fieldError("pkgdesc", "missing pkgdesc")
 	}
 
-	if len(m.Sources) == 0 {
-		return nil, fmt.Errorf("missing source")
+	if len(m.Sources) == 0 && len(m.TargetSources) == 0 {
+		return nil, fieldError("source", "missing source")
+	}
+
+	if len(missing) > 0 {
+		return nil, fieldError(missing[0]+"()", "invalid PKGBUILD: missing %s()", missing[0])
 	}
 
 	return m, nil
 }
 
-func validateHooks(path string) error {
-	script := fmt.Sprintf(`
-        source "%s"
-        if ! type -t produces &>/dev/null; then
-            echo "missing produces()" >&2
-            exit 1
-        fi
-        if ! type -t build &>/dev/null; then
-            echo "missing build()" >&2
-            exit 1
-        fi
-    `, path)
-
-	cmd := exec.Command("bash", "-c", script)
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
-
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("invalid PKGBUILD: %s", strings.TrimSpace(stderr.String()))
-	}
-	return nil
+// parseConditional reads a target-conditional array, e.g. depends_linux_arm64=a b
+func parseConditional(m *domain.Module, line string) {
+	name, values, _ := strings.Cut(line, "=")
+
+	var array string
+	var bySuffix *map[string][]string
+	switch {
+	case strings.HasPrefix(name, "makedepends_"):
+		array, bySuffix = "makedepends_", &m.TargetMakeDepends
+	case strings.HasPrefix(name, "depends_"):
+		array, bySuffix = "depends_", &m.TargetDepends
+	case strings.HasPrefix(name, "source_"):
+		array, bySuffix = "source_", &m.TargetSources
+	default:
+		return
+	}
+
+	suffix := strings.TrimPrefix(name, array)
+	if suffix == "" {
+		return
+	}
+	if *bySuffix == nil {
+		*bySuffix = make(map[string][]string)
+	}
+	(*bySuffix)[suffix] = strings.Fields(values)
+}
+
+// parseTimeout accepts seconds (timeout=600) or a duration (timeout=10m)
+func parseTimeout(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, nil
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout < 0 {
+		return 0, fmt.Errorf("invalid timeout %q", value)
+	}
+	return timeout, nil
 }
 
 // func (l *BashLoader) LoadAll(rootDir string) ([]*domain.Module, error) {
@@ -168,7 +268,12 @@ func validateHooks(path string) error {
 // }
 
 func (l *BashLoader) LoadAll(rootDir string) ([]*domain.Module, error) {
-	var modules []*domain.Module
+	return loadAll(rootDir, l.Load, l.pool.Size())
+}
+
+// loadAll loads every PKGBUILD under rootDir with load, jobs at once
+func loadAll(rootDir string, load func(path string) (*domain.Module, error), jobs int) ([]*domain.Module, error) {
+	var paths []string
 
 	err := filepath.WalkDir(rootDir, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
@@ -193,13 +298,7 @@ func (l *BashLoader) LoadAll(rootDir string) ([]*domain.Module, error) {
 		// Todo config
 
 		if !d.IsDir() && strings.EqualFold(d.Name(), "PKGBUILD") {
-			m, err := l.Load(path)
-			if err != nil {
-				// improve this
-				return ErrModuleLoaderNoLoadingModule
-			}
-
-			modules = append(modules, m)
+			paths = append(paths, path)
 		}
 
 		return nil
@@ -210,5 +309,30 @@ func (l *BashLoader) LoadAll(rootDir string) ([]*domain.Module, error) {
 		return nil, err
 	}
 
+	// in walk order whatever the order they are loaded in
+	modules := make([]*domain.Module, len(paths))
+	errs := make([]error, len(paths))
+	sem := make(chan struct{}, max(jobs, 1))
+	var wg sync.WaitGroup
+	for i, path := range paths {
+		sem <- struct{}{}
+		wg.Go(func() {
+			defer func() { <-sem }()
+			modules[i], errs[i] = load(path)
+		})
+	}
+	wg.Wait()
+
+	// every broken PKGBUILD at once, not only the first one
+	var loadErrs LoadErrors
+	for i, err := range errs {
+		if err != nil {
+			loadErrs.Errors = append(loadErrs.Errors, asLoadError(paths[i], err))
+		}
+	}
+	if len(loadErrs.Errors) > 0 {
+		return nil, &loadErrs
+	}
+
 	return modules, nil
 }
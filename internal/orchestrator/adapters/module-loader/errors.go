@@ -0,0 +1,89 @@
+package moduleloader
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// LoadError is a PKGBUILD that couldn't be loaded
+type LoadError struct {
+	Path   string `json:"path"`
+	Line   int    `json:"line,omitempty"` // of a syntax error
+	Col    int    `json:"col,omitempty"`
+	Field  string `json:"field,omitempty"` // pkgdesc, build()... when one is missing or invalid
+	Msg    string `json:"message"`
+	Stderr string `json:"stderr,omitempty"` // what bash printed reading it
+	Err    error  `json:"-"`
+}
+
+func (e *LoadError) Error() string {
+	var b strings.Builder
+	b.WriteString(e.Path)
+	if e.Line > 0 {
+		fmt.Fprintf(&b, ":%d:%d", e.Line, e.Col)
+	}
+	b.WriteString(": " + e.Msg)
+	if e.Stderr != "" {
+		b.WriteString("\n" + e.Stderr)
+	}
+	return b.String()
+}
+
+func (e *LoadError) Unwrap() error { return e.Err }
+
+func fieldError(field, format string, args ...any) *LoadError {
+	return &LoadError{Field: field, Msg: fmt.Sprintf(format, args...)}
+}
+
+// asLoadError locates err, whatever Load returned
+func asLoadError(path string, err error) *LoadError {
+	var loadErr *LoadError
+	if errors.As(err, &loadErr) {
+		if loadErr.Path == "" {
+			loadErr.Path = path
+		}
+		return loadErr
+	}
+	var syntaxErr *SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return &LoadError{Path: path, Line: syntaxErr.Line, Col: syntaxErr.Col, Msg: syntaxErr.Msg, Err: err}
+	}
+	return &LoadError{Path: path, Msg: err.Error(), Err: err}
+}
+
+// LoadErrors is every PKGBUILD LoadAll couldn't load, in walk order
+type LoadErrors struct {
+	Errors []*LoadError `json:"errors"`
+}
+
+func (e *LoadErrors) Error() string {
+	var b strings.Builder
+	if len(e.Errors) == 1 {
+		b.WriteString("1 PKGBUILD failed to load")
+	} else {
+		fmt.Fprintf(&b, "%d PKGBUILDs failed to load", len(e.Errors))
+	}
+	for _, err := range e.Errors {
+		b.WriteString("\n  " + strings.ReplaceAll(err.Error(), "\n", "\n    "))
+	}
+	return b.String()
+}
+
+func (e *LoadErrors) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, err := range e.Errors {
+		errs[i] = err
+	}
+	return errs
+}
+
+// Is keeps errors.Is(err, ErrModuleLoaderNoLoadingModule) working
+func (e *LoadErrors) Is(target error) bool {
+	return target == ErrModuleLoaderNoLoadingModule
+}
+
+// Details is what the stdio layer publishes, see stdio.DetailedError
+func (e *LoadErrors) Details() any {
+	return e
+}
@@ -1,10 +1,16 @@
 package moduleloader
 
 import (
+	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/73NN0/foe-hammer/internal/orchestrator/domain"
 )
 
 func TestLoad(t *testing.T) {
@@ -51,34 +57,75 @@ func TestLoad(t *testing.T) {
 		},
 	}
 
-	loader := NewBashLoader()
+	loaders := map[string]interface {
+		Load(path string) (*domain.Module, error)
+	}{
+		"bash":   NewBashLoader(),
+		"static": NewStaticLoader(),
+	}
 
 	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			m, err := loader.Load(tt.path)
+		for name, loader := range loaders {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				m, err := loader.Load(tt.path)
+
+				if tt.wantErr {
+					if err == nil {
+						t.Fatal("expected error, got nil")
+					}
+					if tt.errContains != "" && !strings.Contains(err.Error(), tt.errContains) {
+						t.Errorf("expected error containing %q, got %q", tt.errContains, err.Error())
+					}
+					return
+				}
 
-			if tt.wantErr {
-				if err == nil {
-					t.Fatal("expected error, got nil")
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
 				}
-				if tt.errContains != "" && !strings.Contains(err.Error(), tt.errContains) {
-					t.Errorf("expected error containing %q, got %q", tt.errContains, err.Error())
+
+				if m == nil {
+					t.Fatal("expected module, got nil")
 				}
-				return
-			}
 
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
+				if m.Name == "" {
+					t.Error("module name is empty")
+				}
+			})
+		}
+	}
+}
 
-			if m == nil {
-				t.Fatal("expected module, got nil")
-			}
+func TestLoadTargetArrays(t *testing.T) {
+	m, err := NewBashLoader().Load("../../testdata/loader/target-arrays/PKGBUILD")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
 
-			if m.Name == "" {
-				t.Error("module name is empty")
-			}
-		})
+	checks := []struct {
+		name string
+		got  []string
+		want []string
+	}{
+		{"depends", m.Depends, []string{"libcore"}},
+		{"depends_linux", m.TargetDepends["linux"], []string{"platform-unix"}},
+		{"depends_windows", m.TargetDepends["windows"], []string{"platform-win"}},
+		{"depends_x86_64", m.TargetDepends["x86_64"], []string{"libsimd"}},
+		{"makedepends_windows", m.TargetMakeDepends["windows"], []string{"mingw"}},
+		{"source_linux_arm64", m.TargetSources["linux_arm64"], []string{"neon.c"}},
+		{"arch", m.Arch, []string{"x86_64", "aarch64"}},
+		{"os", m.OS, []string{"linux", "windows"}},
+		{"keepenv", m.KeepEnv, []string{"CCACHE_DIR", "SOURCE_DATE_EPOCH"}},
+		{"hooks", m.Hooks, []string{"exports"}},
+	}
+	for _, c := range checks {
+		if !slices.Equal(c.got, c.want) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.want, c.got)
+		}
+	}
+
+	// makedepends_ arrays must not leak into depends
+	if len(m.TargetDepends) != 3 {
+		t.Errorf("expected 3 depends suffixes, got %v", m.TargetDepends)
 	}
 }
 
@@ -110,7 +157,7 @@ func TestValidateHooks(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := validateHooks(tt.path)
+			_, err := NewBashLoader().Load(tt.path)
 
 			if tt.wantErr {
 				if err == nil {
@@ -129,6 +176,39 @@ func TestValidateHooks(t *testing.T) {
 	}
 }
 
+func TestParseTimeout(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "", want: 0},
+		{value: "600", want: 10 * time.Minute},
+		{value: "90s", want: 90 * time.Second},
+		{value: "1h30m", want: 90 * time.Minute},
+		{value: "soon", wantErr: true},
+		{value: "-5m", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseTimeout(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
 func TestLoadAllRecursive(t *testing.T) {
 	loader := NewBashLoader()
 
@@ -249,3 +329,86 @@ build() {
 		t.Fatalf("failed to write dummy.c: %v", err)
 	}
 }
+
+func TestLoadAllErrors(t *testing.T) {
+	rootDir := t.TempDir()
+	pkgbuilds := map[string]string{
+		"good":     "pkgname=good\npkgdesc=ok\nsource=(a.c)\nproduces() { :; }\nbuild() { :; }\n",
+		"nodesc":   "pkgname=nodesc\npkgdesc=$(nosuchcommand)\nsource=(a.c)\nproduces() { :; }\nbuild() { :; }\n",
+		"nobuild":  "pkgname=nobuild\npkgdesc=x\nsource=(a.c)\nproduces() { :; }\n",
+		"unclosed": "pkgname=unclosed\npkgdesc=\"oops\nsource=(a.c)\n",
+	}
+	for dir, src := range pkgbuilds {
+		os.MkdirAll(filepath.Join(rootDir, dir), 0755)
+		if err := os.WriteFile(filepath.Join(rootDir, dir, "PKGBUILD"), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// by walk order: nobuild, nodesc, unclosed
+	want := []struct {
+		dir, field, stderr string
+		line               int
+		only               string // "" for both loaders
+	}{
+		{dir: "nobuild", field: "build()"},
+		{dir: "nodesc", field: "pkgdesc", stderr: "nosuchcommand"},
+		// bash goes on after the syntax error, with pkgdesc unset
+		{dir: "unclosed", field: "pkgdesc", stderr: "unexpected EOF", only: "bash"},
+		{dir: "unclosed", line: 2, only: "static"},
+	}
+
+	for _, loader := range []interface {
+		LoadAll(rootDir string) ([]*domain.Module, error)
+	}{NewBashLoader(), NewStaticLoader()} {
+		name := "bash"
+		if _, static := loader.(*StaticLoader); static {
+			name = "static"
+		}
+		t.Run(name, func(t *testing.T) {
+			_, err := loader.LoadAll(rootDir)
+
+			var loadErrs *LoadErrors
+			if !errors.As(err, &loadErrs) {
+				t.Fatalf("expected LoadErrors, got %v", err)
+			}
+			if !errors.Is(err, ErrModuleLoaderNoLoadingModule) {
+				t.Error("LoadErrors should still be ErrModuleLoaderNoLoadingModule")
+			}
+			wanted := want[:0:0]
+			for _, w := range want {
+				if w.only == "" || w.only == name {
+					wanted = append(wanted, w)
+				}
+			}
+			if len(loadErrs.Errors) != len(wanted) {
+				t.Fatalf("expected %d errors, got %v", len(wanted), err)
+			}
+
+			for i, w := range wanted {
+				got := loadErrs.Errors[i]
+				if got.Path != filepath.Join(rootDir, w.dir, "PKGBUILD") {
+					t.Errorf("error %d: got path %s, want %s", i, got.Path, w.dir)
+				}
+				if got.Field != w.field {
+					t.Errorf("%s: got field %q, want %q", w.dir, got.Field, w.field)
+				}
+				if !strings.Contains(got.Stderr, w.stderr) {
+					t.Errorf("%s: expected stderr containing %q, got %q", w.dir, w.stderr, got.Stderr)
+				}
+				if got.Line != w.line {
+					t.Errorf("%s: got line %d, want %d", w.dir, got.Line, w.line)
+				}
+			}
+
+			// what the stdio layer publishes
+			data, err := json.Marshal(loadErrs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(data), `"field":"build()"`) {
+				t.Errorf("field not serialized: %s", data)
+			}
+		})
+	}
+}
@@ -0,0 +1,510 @@
+package moduleloader
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// The static parser reads the subset of bash PKGBUILDs are written in:
+//
+//	pkgname=liba                  # scalars, quoted or not, comments
+//	depends=(libcore "lib b")     # arrays, on several lines
+//	source+=("$pkgname.c")        # += and $name / ${name} of variables set above
+//	build() { ... }               # functions, the body is skipped
+//
+// Anything else (commands, $(...), globs, variables from the environment...) is
+// ErrUnsupported, StaticLoader asks bash instead.
+
+var ErrUnsupported = errors.New("not supported by the static parser")
+
+// SyntaxError is a PKGBUILD bash would refuse too, e.g. a quote never closed
+type SyntaxError struct {
+	Path      string
+	Line, Col int
+	Msg       string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s", e.Path, e.Line, e.Col, e.Msg)
+}
+
+type unsupportedError struct {
+	line, col int
+	what      string
+}
+
+func (e *unsupportedError) Error() string {
+	return fmt.Sprintf("%d:%d: %s %s", e.line, e.col, e.what, ErrUnsupported)
+}
+
+func (e *unsupportedError) Unwrap() error { return ErrUnsupported }
+
+// pkgbuild is what the static parser got from a PKGBUILD
+type pkgbuild struct {
+	// scalars are arrays of one element, as for bash: $depends is ${depends[0]}
+	vars  map[string][]string
+	funcs []string
+}
+
+type parser struct {
+	path string
+	src  string
+	pos  int
+	line int
+	col  int
+	pb   *pkgbuild
+}
+
+type position struct{ pos, line, col int }
+
+func parsePKGBUILD(path string, src []byte) (*pkgbuild, error) {
+	p := &parser{
+		path: path,
+		src:  string(src),
+		line: 1,
+		col:  1,
+		pb:   &pkgbuild{vars: make(map[string][]string)},
+	}
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	return p.pb, nil
+}
+
+func (p *parser) eof() bool { return p.pos >= len(p.src) }
+
+func (p *parser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *parser) at(s string) bool { return strings.HasPrefix(p.src[p.pos:], s) }
+
+func (p *parser) next() byte {
+	c := p.src[p.pos]
+	p.pos++
+	if c == '\n' {
+		p.line++
+		p.col = 1
+	} else if utf8.RuneStart(c) {
+		p.col++
+	}
+	return c
+}
+
+func (p *parser) skip(n int) {
+	for range n {
+		p.next()
+	}
+}
+
+func (p *parser) mark() position { return position{p.pos, p.line, p.col} }
+
+func (p *parser) syntaxError(at position, format string, args ...any) error {
+	return &SyntaxError{Path: p.path, Line: at.line, Col: at.col, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) unsupported(at position, what string) error {
+	return &unsupportedError{line: at.line, col: at.col, what: what}
+}
+
+// skipSpace skips blanks, and newlines too when newlines is set
+func (p *parser) skipSpace(newlines bool) {
+	for !p.eof() {
+		switch p.peek() {
+		case ' ', '\t':
+			p.next()
+		case '\n':
+			if !newlines {
+				return
+			}
+			p.next()
+		case '\\':
+			// line continuation
+			if !p.at("\\\n") {
+				return
+			}
+			p.skip(2)
+		case '#':
+			for !p.eof() && p.peek() != '\n' {
+				p.next()
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (p *parser) parse() error {
+	for {
+		p.skipSpace(true)
+		for p.peek() == ';' {
+			p.next()
+			p.skipSpace(true)
+		}
+		if p.eof() {
+			return nil
+		}
+		if err := p.statement(); err != nil {
+			return err
+		}
+	}
+}
+
+func (p *parser) statement() error {
+	start := p.mark()
+	name := p.name()
+	if name == "" {
+		return p.unsupported(start, fmt.Sprintf("%q", p.peek()))
+	}
+
+	if name == "function" && (p.peek() == ' ' || p.peek() == '\t') {
+		p.skipSpace(false)
+		fstart := p.mark()
+		fname := p.name()
+		if fname == "" {
+			return p.syntaxError(fstart, "expected a function name")
+		}
+		p.skipSpace(false)
+		if p.at("()") {
+			p.skip(2)
+		}
+		return p.function(start, fname)
+	}
+
+	if p.peek() == '=' || p.at("+=") {
+		return p.assignments(name)
+	}
+
+	p.skipSpace(false)
+	if p.peek() == '(' {
+		p.next()
+		p.skipSpace(false)
+		if p.peek() != ')' {
+			return p.syntaxError(p.mark(), "expected ) after %s(", name)
+		}
+		p.next()
+		return p.function(start, name)
+	}
+
+	return p.unsupported(start, "command "+name)
+}
+
+// name reads a variable or function name, empty when there is none
+func (p *parser) name() string {
+	start := p.pos
+	for !p.eof() {
+		c := p.peek()
+		if c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || p.pos > start && c >= '0' && c <= '9' {
+			p.next()
+			continue
+		}
+		break
+	}
+	return p.src[start:p.pos]
+}
+
+// assignments reads name=value, and the ones following it on the same statement
+func (p *parser) assignments(name string) error {
+	for {
+		appending := p.at("+=")
+		if appending {
+			p.skip(2)
+		} else {
+			p.next()
+		}
+
+		var values []string
+		if p.peek() == '(' {
+			array, err := p.array()
+			if err != nil {
+				return err
+			}
+			values = array
+			if appending {
+				values = append(slices.Clone(p.pb.vars[name]), values...)
+			}
+		} else {
+			word, err := p.word(false)
+			if err != nil {
+				return err
+			}
+			values = []string{word}
+			if old := p.pb.vars[name]; appending && len(old) > 0 {
+				values = append([]string{old[0] + word}, old[1:]...)
+			}
+		}
+		p.pb.vars[name] = values
+
+		p.skipSpace(false)
+		if p.eof() || p.peek() == '\n' || p.peek() == ';' {
+			return nil
+		}
+
+		// a=1 b=2, or a=1 command
+		at := p.mark()
+		name = p.name()
+		if name == "" || p.peek() != '=' && !p.at("+=") {
+			return p.unsupported(at, "command after an assignment")
+		}
+	}
+}
+
+// array reads (word word...)
+func (p *parser) array() ([]string, error) {
+	start := p.mark()
+	p.next()
+
+	values := []string{}
+	for {
+		p.skipSpace(true)
+		if p.eof() {
+			return nil, p.syntaxError(start, "unterminated array, missing )")
+		}
+		if p.peek() == ')' {
+			p.next()
+			return values, nil
+		}
+		word, err := p.word(true)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, word)
+	}
+}
+
+// word reads a word until a blank, quotes and expansions included
+func (p *parser) word(inArray bool) (string, error) {
+	var b strings.Builder
+	first := true
+	for !p.eof() {
+		at := p.mark()
+		c := p.peek()
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == ';':
+			return b.String(), nil
+		case c == ')' && inArray:
+			return b.String(), nil
+		case c == '(' || c == ')':
+			return "", p.syntaxError(at, "unexpected %c", c)
+		case c == '\'':
+			p.next()
+			end := strings.IndexByte(p.src[p.pos:], '\'')
+			if end < 0 {
+				return "", p.syntaxError(at, "unterminated single quote")
+			}
+			b.WriteString(p.src[p.pos : p.pos+end])
+			p.skip(end + 1)
+		case c == '"':
+			s, err := p.doubleQuoted()
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(s)
+		case c == '\\':
+			p.next()
+			if p.eof() {
+				return b.String(), nil
+			}
+			if p.peek() == '\n' {
+				p.next()
+				continue
+			}
+			b.WriteByte(p.next())
+		case c == '$':
+			value, err := p.expansion()
+			if err != nil {
+				return "", err
+			}
+			// unquoted, bash would split it into several words
+			if strings.ContainsAny(value, " \t\n*?[") || value == "" && inArray {
+				return "", p.unsupported(at, "unquoted expansion")
+			}
+			b.WriteString(value)
+		case c == '`':
+			return "", p.unsupported(at, "command substitution")
+		case strings.IndexByte("*?[{}", c) >= 0:
+			return "", p.unsupported(at, "glob or brace expansion")
+		case strings.IndexByte("<>|&", c) >= 0:
+			return "", p.unsupported(at, "redirection or pipeline")
+		case c == '~' && first:
+			return "", p.unsupported(at, "tilde expansion")
+		default:
+			b.WriteByte(p.next())
+		}
+		first = false
+	}
+	return b.String(), nil
+}
+
+func (p *parser) doubleQuoted() (string, error) {
+	start := p.mark()
+	p.next()
+
+	var b strings.Builder
+	for {
+		if p.eof() {
+			return "", p.syntaxError(start, "unterminated double quote")
+		}
+		at := p.mark()
+		switch c := p.peek(); c {
+		case '"':
+			p.next()
+			return b.String(), nil
+		case '\\':
+			p.next()
+			if p.eof() {
+				continue
+			}
+			switch e := p.peek(); e {
+			case '$', '`', '"', '\\':
+				b.WriteByte(p.next())
+			case '\n':
+				p.next()
+			default:
+				b.WriteByte('\\')
+			}
+		case '$':
+			value, err := p.expansion()
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(value)
+		case '`':
+			return "", p.unsupported(at, "command substitution")
+		default:
+			b.WriteByte(p.next())
+		}
+	}
+}
+
+// expansion reads $name or ${name}, of a variable set before in the PKGBUILD
+func (p *parser) expansion() (string, error) {
+	at := p.mark()
+	p.next()
+
+	braced := p.peek() == '{'
+	if braced {
+		p.next()
+	}
+	name := p.name()
+	if name == "" {
+		if !braced && (p.eof() || strings.IndexByte(" \t\n\";)", p.peek()) >= 0) {
+			// a lone $ is kept
+			return "$", nil
+		}
+		return "", p.unsupported(at, "expansion")
+	}
+	if braced {
+		if p.peek() != '}' {
+			return "", p.unsupported(at, "parameter expansion")
+		}
+		p.next()
+	}
+
+	values, ok := p.pb.vars[name]
+	if !ok {
+		// from the environment, bash knows better
+		return "", p.unsupported(at, "$"+name)
+	}
+	if len(values) == 0 {
+		return "", nil
+	}
+	return values[0], nil
+}
+
+// function skips the body of name, after name() or function name.
+// The body is only skimmed, whatever it can't follow is left to bash.
+func (p *parser) function(start position, name string) error {
+	p.skipSpace(true)
+	if p.peek() != '{' {
+		if p.eof() {
+			return p.syntaxError(start, "missing body of %s()", name)
+		}
+		return p.unsupported(p.mark(), "body of "+name+"() not in { }")
+	}
+	p.next()
+
+	depth := 1 // { } groups
+	params := 0
+	prev := byte('{')
+	for depth > 0 {
+		if p.eof() {
+			return p.unsupported(start, "body of "+name+"() without its }")
+		}
+		at := p.mark()
+		c := p.peek()
+		wordStart := strings.IndexByte(" \t\n;&|({", prev) >= 0
+
+		switch {
+		case c == '\'':
+			p.next()
+			end := strings.IndexByte(p.src[p.pos:], '\'')
+			if end < 0 {
+				// $'it\'s' too
+				return p.unsupported(at, "quote in the body of "+name+"()")
+			}
+			p.skip(end + 1)
+		case c == '"':
+			if err := p.skipDoubleQuoted(); err != nil {
+				return err
+			}
+		case c == '\\':
+			p.skip(min(2, len(p.src)-p.pos))
+		case c == '#' && wordStart:
+			for !p.eof() && p.peek() != '\n' {
+				p.next()
+			}
+		case p.at("<<") && !p.at("<<<"):
+			return p.unsupported(at, "here-document")
+		case p.at("${"):
+			p.skip(2)
+			params++
+		case c == '{' && wordStart && p.pos+1 < len(p.src) && strings.IndexByte(" \t\n", p.src[p.pos+1]) >= 0:
+			// the { keyword, not {a,b}
+			p.next()
+			depth++
+		case c == '}' && params > 0:
+			p.next()
+			params--
+		case c == '}' && wordStart:
+			p.next()
+			depth--
+		default:
+			p.next()
+		}
+		prev = c
+	}
+
+	p.pb.funcs = append(p.pb.funcs, name)
+	return nil
+}
+
+// skipDoubleQuoted skips "...", unlike doubleQuoted nothing is expanded.
+// "$(echo '"')" quotes again inside, it is left to bash.
+func (p *parser) skipDoubleQuoted() error {
+	start := p.mark()
+	p.next()
+	for {
+		if p.eof() {
+			return p.unsupported(start, "unterminated double quote")
+		}
+		at := p.mark()
+		if p.at("$(") || p.at("`") {
+			return p.unsupported(at, "command substitution in a double quote")
+		}
+		switch p.next() {
+		case '"':
+			return nil
+		case '\\':
+			if !p.eof() {
+				p.next()
+			}
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package moduleloader
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	bashpool "github.com/73NN0/foe-hammer/internal/orchestrator/adapters/bash-pool"
+	"github.com/73NN0/foe-hammer/internal/orchestrator/domain"
+)
+
+// StaticLoader reads PKGBUILDs without running them, see parse.go.
+// PKGBUILDs using more bash than the static parser understands are loaded by a BashLoader.
+type StaticLoader struct {
+	fallback *BashLoader
+}
+
+func NewStaticLoader() *StaticLoader {
+	return &StaticLoader{fallback: NewBashLoader()}
+}
+
+// SetPool is the pool of the fallback, see BashLoader.SetPool
+func (l *StaticLoader) SetPool(pool *bashpool.Pool) {
+	l.fallback.SetPool(pool)
+}
+
+func (l *StaticLoader) Close() error {
+	return l.fallback.Close()
+}
+
+func (l *StaticLoader) Load(path string) (*domain.Module, error) {
+	absPath, err := filepath.Abs(filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("resolving path %s: %w", path, err)
+	}
+	src, err := os.ReadFile(absPath)
+	if err != nil {
+		return nil, err
+	}
+
+	pb, err := parsePKGBUILD(path, src)
+	if errors.Is(err, ErrUnsupported) {
+		return l.fallback.Load(path)
+	}
+	if err != nil {
+		return nil, asLoadError(path, err)
+	}
+
+	// same output as buildScript, so both loaders read PKGBUILDs the same way
+	m, err := l.fallback.parseTagged(bytes.NewBufferString(pb.tagged()))
+	if err != nil {
+		return nil, asLoadError(path, err)
+	}
+
+	m.DirPath = filepath.Dir(absPath)
+	m.Path = absPath
+	return m, nil
+}
+
+func (l *StaticLoader) LoadAll(rootDir string) ([]*domain.Module, error) {
+	return loadAll(rootDir, l.Load, l.fallback.pool.Size())
+}
+
+// tagged prints the variables like buildScript does
+func (pb *pkgbuild) tagged() string {
+	var b strings.Builder
+	// "$pkgname", the first element if it is an array
+	for _, v := range []struct{ tag, name string }{
+		{tagName, "pkgname"},
+		{tagDesc, "pkgdesc"},
+		{tagTime, "timeout"},
+	} {
+		var value string
+		if values := pb.vars[v.name]; len(values) > 0 {
+			value = values[0]
+		}
+		fmt.Fprintf(&b, "%s%s\n", v.tag, value)
+	}
+
+	// "${depends[*]}"
+	for _, v := range []struct{ tag, name string }{
+		{tagDeps, "depends"},
+		{tagMake, "makedepends"},
+		{tagHost, "hostdepends"},
+		{tagSrcs, "source"},
+		{tagProv, "provides"},
+		{tagConf, "conflicts"},
+		{tagArch, "arch"},
+		{tagOS, "os"},
+		{tagKeep, "keepenv"},
+	} {
+		fmt.Fprintf(&b, "%s%s\n", v.tag, strings.Join(pb.vars[v.name], " "))
+	}
+
+	for _, hook := range optionalHooks {
+		if slices.Contains(pb.funcs, hook) {
+			fmt.Fprintf(&b, "%s%s\n", tagHook, hook)
+		}
+	}
+	for _, hook := range requiredHooks {
+		if !slices.Contains(pb.funcs, hook) {
+			fmt.Fprintf(&b, "%s%s\n", tagMiss, hook)
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(pb.vars)) {
+		for _, prefix := range []string{"depends_", "makedepends_", "source_"} {
+			if strings.HasPrefix(name, prefix) {
+				fmt.Fprintf(&b, "%s%s=%s\n", tagCond, name, strings.Join(pb.vars[name], " "))
+			}
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,182 @@
+package moduleloader
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// the static parser must read the PKGBUILDs of the repo exactly like bash
+func TestStaticLoaderMatchesBash(t *testing.T) {
+	paths := []string{
+		"../../testdata/loader/valid/PKGBUILD",
+		"../../testdata/loader/target-arrays/PKGBUILD",
+		"../../testdata/simple/liba/PKGBUILD",
+		"../../testdata/simple/libb/PKGBUILD",
+		"../../testdata/simple/app/PKGBUILD",
+	}
+
+	for _, path := range paths {
+		t.Run(path, func(t *testing.T) {
+			src, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := parsePKGBUILD(path, src); err != nil {
+				t.Fatalf("static parser: %v", err)
+			}
+
+			want, err := NewBashLoader().Load(path)
+			if err != nil {
+				t.Fatalf("BashLoader: %v", err)
+			}
+			got, err := NewStaticLoader().Load(path)
+			if err != nil {
+				t.Fatalf("StaticLoader: %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("StaticLoader got\n%+v\nBashLoader got\n%+v", got, want)
+			}
+		})
+	}
+
+	// the static parser leaves these to bash, the result must not change
+	fallbacks := map[string]string{
+		"quote in a command substitution": `pkgname=gen
+pkgdesc="Quotes in quotes"
+source=(PKGBUILD)
+produces() { echo "lib/lib$(echo '"' | tr -d '"')gen.a"; }
+build() { echo "}"; }
+`,
+	}
+	for name, src := range fallbacks {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "PKGBUILD")
+			if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := parsePKGBUILD(path, []byte(src)); !errors.Is(err, ErrUnsupported) {
+				t.Fatalf("static parser: expected ErrUnsupported, got %v", err)
+			}
+
+			want, err := NewBashLoader().Load(path)
+			if err != nil {
+				t.Fatalf("BashLoader: %v", err)
+			}
+			got, err := NewStaticLoader().Load(path)
+			if err != nil {
+				t.Fatalf("StaticLoader: %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("StaticLoader got\n%+v\nBashLoader got\n%+v", got, want)
+			}
+		})
+	}
+}
+
+func TestParsePKGBUILD(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want map[string][]string
+	}{
+		{
+			name: "quoting",
+			src:  `a=plain b='single $x' c="double \"q\"" d=con'cat'"ed"`,
+			want: map[string][]string{"a": {"plain"}, "b": {"single $x"}, "c": {`double "q"`}, "d": {"concated"}},
+		},
+		{
+			name: "arrays on several lines with comments",
+			src:  "depends=(\n  liba # the base\n  'lib b'\n)\nempty=()",
+			want: map[string][]string{"depends": {"liba", "lib b"}, "empty": {}},
+		},
+		{
+			name: "expansions and +=",
+			src:  "pkgname=foo\nsource=(\"$pkgname.c\" ${pkgname}_x.c)\nsource+=(extra.c)\npkgdesc=\"$pkgname lib\"\npkgdesc+=!",
+			want: map[string][]string{
+				"pkgname": {"foo"},
+				"source":  {"foo.c", "foo_x.c", "extra.c"},
+				"pkgdesc": {"foo lib!"},
+			},
+		},
+		{
+			name: "functions are skipped",
+			src:  "build() {\n  if [ -n \"${x}\" ]; then { echo '}'; }; fi\n  echo {a,b} # }\n}\nfunction produces {\n  echo lib.a\n}\nafter=1",
+			want: map[string][]string{"after": {"1"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb, err := parsePKGBUILD("PKGBUILD", []byte(tt.src))
+			if err != nil {
+				t.Fatalf("parsePKGBUILD: %v", err)
+			}
+			if !reflect.DeepEqual(pb.vars, tt.want) {
+				t.Errorf("got %q, want %q", pb.vars, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePKGBUILDErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		wantErr string // "" means ErrUnsupported, bash is asked instead
+	}{
+		{name: "unterminated quote", src: "pkgname=a\npkgdesc=\"oops\n", wantErr: "PKGBUILD:2:9: unterminated double quote"},
+		{name: "unterminated array", src: "depends=(a\n  b", wantErr: "PKGBUILD:1:9: unterminated array, missing )"},
+		{name: "unterminated function", src: "x=1\nbuild() {\n  echo"},
+		{name: "command substitution", src: "source=($(ls *.c))"},
+		{name: "glob", src: "source=(*.c)"},
+		{name: "environment variable", src: "pkgname=$USER"},
+		{name: "command", src: "pkgname=a\nif true; then x=1; fi"},
+		{name: "here-document", src: "build() {\n  cat <<EOF\n}\nEOF\n}"},
+		{name: "quote in a command substitution", src: "produces() { echo \"$(echo '\"')\"; }"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parsePKGBUILD("PKGBUILD", []byte(tt.src))
+			if tt.wantErr == "" {
+				if !errors.Is(err, ErrUnsupported) {
+					t.Fatalf("expected ErrUnsupported, got %v", err)
+				}
+				return
+			}
+
+			var syntaxErr *SyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("expected a SyntaxError, got %v", err)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %q", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestStaticLoaderFallback(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "PKGBUILD")
+	pkgbuild := `pkgname=$(echo dynamic)
+pkgdesc="Computed by bash"
+source=(a.c)
+produces() { echo lib/a.a; }
+build() { :; }
+`
+	if err := os.WriteFile(path, []byte(pkgbuild), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewStaticLoader().Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if m.Name != "dynamic" {
+		t.Errorf("expected pkgname from bash, got %q", m.Name)
+	}
+}
@@ -0,0 +1,182 @@
+package toolchain
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/73NN0/foe-hammer/internal/orchestrator/domain"
+)
+
+// Ext is the extension of toolchain descriptors
+const Ext = ".toolchain"
+
+var ErrInvalidToolchain = errors.New("invalid toolchain")
+
+// Load reads a toolchain descriptor, KEY=VALUE lines like a shell file:
+//
+//	# toolchains/linux-arm64.toolchain
+//	CC=aarch64-linux-gnu-gcc
+//	AR=aarch64-linux-gnu-ar
+//	SYSROOT=sysroots/arm64   # relative to the descriptor
+//	CFLAGS="-O2 -march=armv8-a"
+func Load(path string) (*domain.Toolchain, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tc := &domain.Toolchain{Name: strings.TrimSuffix(filepath.Base(path), Ext)}
+	fields := map[string]*string{
+		"CC":       &tc.CC,
+		"CXX":      &tc.CXX,
+		"AR":       &tc.AR,
+		"LD":       &tc.LD,
+		"SYSROOT":  &tc.Sysroot,
+		"CFLAGS":   &tc.CFlags,
+		"CXXFLAGS": &tc.CXXFlags,
+		"LDFLAGS":  &tc.LDFlags,
+	}
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		field, known := fields[strings.TrimSpace(key)]
+		if !ok || !known {
+			return nil, fmt.Errorf("%w: %s:%d: expected one of CC CXX AR LD SYSROOT CFLAGS CXXFLAGS LDFLAGS, got %q", ErrInvalidToolchain, path, n, line)
+		}
+		value, err := unquote(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s:%d: %s: %w", ErrInvalidToolchain, path, n, key, err)
+		}
+		*field = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+
+	if tc.Sysroot != "" && !filepath.IsAbs(tc.Sysroot) {
+		tc.Sysroot = filepath.Join(filepath.Dir(path), tc.Sysroot)
+	}
+	return tc, nil
+}
+
+// unquote strips a trailing comment and the quotes around value
+func unquote(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || value[0] != '"' && value[0] != '\'' {
+		if i := strings.Index(value, " #"); i >= 0 {
+			value = value[:i]
+		}
+		return strings.TrimSpace(value), nil
+	}
+
+	// the closing quote is the first one not escaped, a comment may hold others
+	quote := value[0]
+	end := -1
+	for i := 1; i < len(value); i++ {
+		if quote == '"' && value[i] == '\\' {
+			i++
+			continue
+		}
+		if value[i] == quote {
+			end = i
+			break
+		}
+	}
+	if end < 0 {
+		return "", errors.New("missing closing quote")
+	}
+
+	if rest := strings.TrimSpace(value[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+		return "", fmt.Errorf("unexpected %q after the closing quote", rest)
+	}
+	if quote == '\'' {
+		return value[1:end], nil
+	}
+	return strconv.Unquote(value[:end+1])
+}
+
+// Set holds the toolchains of a project, see Find
+type Set struct {
+	byName    map[string]*domain.Toolchain
+	overrides map[domain.Target]*domain.Toolchain
+}
+
+// LoadDir reads every descriptor of dir, usually <root>/toolchains.
+// A missing dir is an empty set.
+func LoadDir(dir string) (*Set, error) {
+	s := &Set{byName: make(map[string]*domain.Toolchain)}
+	if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+Ext))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range paths {
+		tc, err := Load(path)
+		if err != nil {
+			return nil, err
+		}
+		s.byName[tc.Name] = tc
+	}
+	return s, nil
+}
+
+// Override uses tc for target whatever the descriptors, see --toolchain
+func (s *Set) Override(target domain.Target, tc *domain.Toolchain) {
+	if s.overrides == nil {
+		s.overrides = make(map[domain.Target]*domain.Toolchain)
+	}
+	s.overrides[target] = tc
+}
+
+// Resolve returns a toolchain by name from the set, or by path
+func (s *Set) Resolve(nameOrPath string) (*domain.Toolchain, error) {
+	if strings.HasSuffix(nameOrPath, Ext) || strings.ContainsRune(nameOrPath, filepath.Separator) {
+		return Load(nameOrPath)
+	}
+	if tc, ok := s.byName[nameOrPath]; ok {
+		return tc, nil
+	}
+	return nil, fmt.Errorf("no toolchain %s", nameOrPath)
+}
+
+// Find returns the toolchain of target, nil if there is none.
+// An override wins, then the first descriptor named after the target, see names.
+func (s *Set) Find(target domain.Target) *domain.Toolchain {
+	if tc, ok := s.overrides[target]; ok {
+		return tc
+	}
+	for _, name := range names(target) {
+		if tc, ok := s.byName[name]; ok {
+			return tc
+		}
+	}
+	return nil
+}
+
+// names returns the descriptor names matching target, in lookup order:
+//
+//	Target{OS: "linux", Arch: "arm64"} => aarch64-linux-gnu arm64-linux linux-arm64 aarch64-linux linux-aarch64
+func names(target domain.Target) []string {
+	names := []string{target.Triple(), target.String(), target.OS + "-" + target.Arch}
+	if gnu := target.GNUArch(); gnu != target.Arch {
+		names = append(names, gnu+"-"+target.OS, target.OS+"-"+gnu)
+	}
+	return names
+}
@@ -0,0 +1,131 @@
+package toolchain_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/73NN0/foe-hammer/internal/orchestrator/adapters/toolchain"
+	"github.com/73NN0/foe-hammer/internal/orchestrator/domain"
+)
+
+func writeToolchain(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name+toolchain.Ext)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	path := writeToolchain(t, dir, "linux-arm64", `# cross gcc
+CC=aarch64-linux-gnu-gcc
+CXX = aarch64-linux-gnu-g++
+AR=aarch64-linux-gnu-ar # comment
+SYSROOT=sysroots/arm64
+CFLAGS="-O2 -march=armv8-a" # use "fast" one day
+LDFLAGS='-static' # 'quoted' too
+`)
+
+	tc, err := toolchain.Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	want := domain.Toolchain{
+		Name:    "linux-arm64",
+		CC:      "aarch64-linux-gnu-gcc",
+		CXX:     "aarch64-linux-gnu-g++",
+		AR:      "aarch64-linux-gnu-ar",
+		Sysroot: filepath.Join(dir, "sysroots/arm64"),
+		CFlags:  "-O2 -march=armv8-a",
+		LDFlags: "-static",
+	}
+	if *tc != want {
+		t.Errorf("expected %+v, got %+v", want, *tc)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{name: "unknown key", content: "CC=gcc\nCPP=cpp\n", wantErr: ":2: expected one of"},
+		{name: "not a key value", content: "gcc\n", wantErr: ":1: expected one of"},
+		{name: "unclosed quote", content: "CFLAGS=\"-O2\n", wantErr: ":1: CFLAGS: missing closing quote"},
+		{name: "text after the quotes", content: "CFLAGS=\"-O2\" -g\n", wantErr: `:1: CFLAGS: unexpected "-g" after the closing quote`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeToolchain(t, t.TempDir(), "broken", tt.content)
+			_, err := toolchain.Load(path)
+			if !errors.Is(err, toolchain.ErrInvalidToolchain) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestFind(t *testing.T) {
+	dir := t.TempDir()
+	writeToolchain(t, dir, "linux-arm64", "CC=aarch64-linux-gnu-gcc\n")
+	writeToolchain(t, dir, "x86_64-windows", "CC=x86_64-w64-mingw32-gcc\n")
+	writeToolchain(t, dir, "clang", "CC=clang\n")
+	writeToolchain(t, dir, "aarch64-linux-musl", "CC=aarch64-linux-musl-gcc\n")
+
+	set, err := toolchain.LoadDir(dir)
+	if err != nil {
+		t.Fatalf("LoadDir: %v", err)
+	}
+
+	linuxArm := domain.Target{OS: "linux", Arch: "arm64"}
+	tests := []struct {
+		target domain.Target
+		want   string // toolchain name, "" for none
+	}{
+		{target: linuxArm, want: "linux-arm64"},
+		{target: domain.Target{OS: "windows", Arch: "amd64"}, want: "x86_64-windows"},
+		{target: domain.Target{OS: "plan9", Arch: "amd64"}},
+		{target: domain.Target{OS: "linux", Arch: "arm64", ABI: "musl"}, want: "aarch64-linux-musl"},
+	}
+	for _, tt := range tests {
+		got := set.Find(tt.target)
+		switch {
+		case got == nil && tt.want != "":
+			t.Errorf("%s: expected %s, got none", tt.target, tt.want)
+		case got != nil && got.Name != tt.want:
+			t.Errorf("%s: expected %q, got %s", tt.target, tt.want, got.Name)
+		}
+	}
+
+	// --toolchain clang
+	clang, err := set.Resolve("clang")
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	set.Override(linuxArm, clang)
+	if got := set.Find(linuxArm); got == nil || got.CC != "clang" {
+		t.Errorf("expected the override, got %+v", got)
+	}
+
+	if _, err := set.Resolve("missing"); err == nil {
+		t.Error("expected an error for an unknown toolchain")
+	}
+}
+
+func TestLoadDirMissing(t *testing.T) {
+	set, err := toolchain.LoadDir(filepath.Join(t.TempDir(), "toolchains"))
+	if err != nil {
+		t.Fatalf("LoadDir: %v", err)
+	}
+	if tc := set.Find(domain.NewTarget()); tc != nil {
+		t.Errorf("expected no toolchain, got %+v", tc)
+	}
+}
@@ -0,0 +1,128 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/73NN0/foe-hammer/internal/orchestrator/domain"
+)
+
+// fingerprint hashes every input of a module:
+// its PKGBUILD, its source files, the env of its hooks, its produces
+// and the fingerprints of its dependencies, host tools ones under host:<name>.
+// The out dir is replaced by a placeholder in the env so the same module
+// has the same fingerprint whatever the out dir.
+func fingerprint(m *domain.Module, env map[string]string, outDir string, deps map[string]string) (string, error) {
+	h := sha256.New()
+
+	// 1. PKGBUILD
+	if err := hashFile(h, "pkgbuild", m.Path); err != nil {
+		return "", err
+	}
+
+	// 2. sources, in declaration order
+	for _, src := range m.Sources {
+		path := src
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(m.DirPath, src)
+		}
+		if err := hashSource(h, "source "+src, path); err != nil {
+			return "", err
+		}
+	}
+
+	// 3. env, sorted so map order doesn't matter
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		v := strings.ReplaceAll(env[k], outDir, "$FOE_OUTDIR")
+		fmt.Fprintf(h, "env %s=%s\x00", k, v)
+	}
+
+	// 4. produces
+	for _, p := range m.Produces {
+		fmt.Fprintf(h, "produces %s\x00", p)
+	}
+
+	// 5. dependencies
+	depNames := slices.Clone(m.Depends)
+	slices.Sort(depNames)
+	for _, dep := range depNames {
+		fmt.Fprintf(h, "depends %s=%s\x00", dep, deps[dep])
+	}
+	for _, tool := range m.HostDepends {
+		fmt.Fprintf(h, "hostdepends %s=%s\x00", tool, deps["host:"+tool])
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashSource hashes a source file, every file of a source dir,
+// or records that it is missing: it may be generated later, by the build of a dependency...
+func hashSource(w io.Writer, label, path string) error {
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		fmt.Fprintf(w, "%s\x00missing\x00", label)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("fingerprinting %s: %w", label, err)
+	}
+	if !info.IsDir() {
+		return hashFile(w, label, path)
+	}
+
+	// WalkDir goes in lexical order, the hash doesn't depend on the filesystem
+	fmt.Fprintf(w, "%s\x00dir\x00", label)
+	return filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("fingerprinting %s: %w", label, err)
+		}
+		if d.IsDir() {
+			if p != path && slices.Contains(vcsDirs, d.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, _ := filepath.Rel(path, p)
+		name := label + "/" + filepath.ToSlash(rel)
+		if d.Type()&fs.ModeSymlink != 0 {
+			target, err := os.Readlink(p)
+			if err != nil {
+				return fmt.Errorf("fingerprinting %s: %w", label, err)
+			}
+			fmt.Fprintf(w, "%s\x00symlink %s\x00", name, target)
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		return hashFile(w, name, p)
+	})
+}
+
+func hashFile(w io.Writer, label, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("fingerprinting %s: %w", label, err)
+	}
+	defer f.Close()
+
+	fmt.Fprintf(w, "%s\x00", label)
+	if _, err := io.Copy(w, f); err != nil {
+		return fmt.Errorf("fingerprinting %s: %w", label, err)
+	}
+	fmt.Fprint(w, "\x00")
+	return nil
+}
@@ -0,0 +1,162 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+
+	"github.com/73NN0/foe-hammer/internal/orchestrator/domain"
+)
+
+// hostdepends=() modules are tools run by the hooks (code generators...).
+// In a native build they are plain depends.
+// In a cross build they are built for the host into the host tree,
+// by a second orchestrator sharing the loaded modules and the settings:
+//
+//	bin/host/bin/protoc-gen         built for the host
+//	bin/arm64-linux/lib/libproto.a  built for the target, protoc-gen on its PATH
+
+// hostBinDir is where the hooks find the host tools, FOE_HOST_BINDIR
+func (o *Orchestrator) hostBinDir(target domain.Target) string {
+	if !o.host.CrossCompilingTo(target) {
+		return filepath.Join(o.outDir, "bin")
+	}
+	return filepath.Join(o.hostDir, "bin")
+}
+
+// forHost returns an orchestrator building modules into the host tree
+func (o *Orchestrator) forHost(modules []*domain.Module) *Orchestrator {
+	return &Orchestrator{
+		loader:          o.loader,
+		context:         o.context,
+		runner:          o.runner,
+		checker:         o.checker,
+		host:            o.host,
+		modules:         modules,
+		rootDir:         o.rootDir,
+		outDir:          o.hostDir,
+		hostDir:         o.hostDir,
+		noarchDir:       o.noarchDir,
+		jobs:            o.jobs,
+		store:           o.store,
+		force:           o.force,
+		cache:           o.cache,
+		keepGoing:       o.keepGoing,
+		timeout:         o.timeout,
+		warnUndeclared:  o.warnUndeclared,
+		sourceCheck:     o.sourceCheck,
+		strictSources:   o.strictSources,
+		staging:         o.staging,
+		providers:       o.providers,
+		targetProviders: o.targetProviders,
+	}
+}
+
+// planHost plans the host tools of the graph for a cross build, see forHost.
+// Only the host tools and what they depend on are resolved for the host,
+// the other modules may well not support it.
+func (o *Orchestrator) planHost(ctx context.Context, target domain.Target) error {
+	o.hostBuild = nil
+	if !o.host.CrossCompilingTo(target) {
+		return nil
+	}
+
+	var tools []string
+	for _, m := range o.graph.All() {
+		tools = append(tools, m.HostDepends...)
+	}
+	if len(tools) == 0 {
+		return nil
+	}
+
+	hostBuild := o.forHost(hostClosure(o.modules, tools, o.host.Target()))
+	if err := hostBuild.Plan(ctx, o.host.Target()); err != nil {
+		return fmt.Errorf("planning host tools for %s: %w", o.host, err)
+	}
+	for _, tool := range tools {
+		if _, err := hostBuild.graph.Get(tool); err != nil {
+			return fmt.Errorf("host tool %s: %w", tool, err)
+		}
+	}
+
+	o.hostBuild = hostBuild
+	return nil
+}
+
+// hostClosure returns the modules named by tools and everything they need for target,
+// a virtual name brings every module providing it.
+func hostClosure(modules []*domain.Module, tools []string, target domain.Target) []*domain.Module {
+	byName := make(map[string]*domain.Module, len(modules))
+	providers := make(map[string][]*domain.Module)
+	for _, m := range modules {
+		byName[m.Name] = m
+		for _, virtual := range m.Provides {
+			providers[virtual] = append(providers[virtual], m)
+		}
+	}
+
+	seen := make(map[string]bool)
+	var closure []*domain.Module
+	queue := slices.Clone(tools)
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+
+		candidates := providers[name]
+		if m, ok := byName[name]; ok {
+			candidates = []*domain.Module{m}
+		}
+		for _, m := range candidates {
+			if seen[m.Name] {
+				continue
+			}
+			seen[m.Name] = true
+			closure = append(closure, m)
+
+			r := m.ForTarget(target)
+			queue = append(queue, r.Depends...)
+			queue = append(queue, r.HostDepends...)
+		}
+	}
+	return closure
+}
+
+// buildHostTools builds the host tools needed by names before them.
+// Their results are returned named host:<name>.
+func (o *Orchestrator) buildHostTools(ctx context.Context, names []string) ([]domain.ModuleResult, error) {
+	if o.hostBuild == nil {
+		return nil, nil
+	}
+
+	var tools []string
+	for _, name := range names {
+		m, err := o.graph.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, tool := range m.HostDepends {
+			if !slices.Contains(tools, tool) {
+				tools = append(tools, tool)
+			}
+		}
+	}
+	if len(tools) == 0 {
+		return nil, nil
+	}
+
+	fmt.Printf("Building host tools for %s...\n", o.host)
+	err := o.hostBuild.BuildWithDeps(ctx, tools, o.host.Target())
+
+	var results []domain.ModuleResult
+	if report := o.hostBuild.Report(); report != nil {
+		for _, r := range report.Results {
+			r.Name = "host:" + r.Name
+			results = append(results, r)
+		}
+	}
+	if err != nil {
+		return results, fmt.Errorf("building host tools: %w", err)
+	}
+	return results, nil
+}
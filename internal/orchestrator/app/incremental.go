@@ -0,0 +1,137 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/73NN0/foe-hammer/internal/orchestrator/domain"
+)
+
+// fingerprintAll fingerprints every module in topological order,
+// so each module's fingerprint includes its dependencies' ones.
+func (o *Orchestrator) fingerprintAll(target domain.Target) error {
+	fingerprints := make(map[string]string, len(o.graph.Order()))
+	if o.hostBuild != nil {
+		for name, fp := range o.hostBuild.fingerprints {
+			fingerprints["host:"+name] = fp
+		}
+	}
+	for _, name := range o.graph.Order() {
+		m, err := o.graph.Get(name)
+		if err != nil {
+			return err
+		}
+
+		env := o.envFor(m, target)
+		fp, err := fingerprint(m, env, o.dirFor(m), fingerprints)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		fingerprints[name] = fp
+	}
+
+	o.fingerprints = fingerprints
+	return nil
+}
+
+// loadState reads the previous build state of the out dir, and of the noarch dir
+func (o *Orchestrator) loadState() error {
+	if o.store == nil {
+		return nil
+	}
+
+	state, err := o.store.Load(o.outDir)
+	if err != nil {
+		return err
+	}
+	noarchState, err := o.store.Load(o.noarchDir)
+	if err != nil {
+		return err
+	}
+
+	o.state = state
+	o.noarchState = noarchState
+	return nil
+}
+
+// upToDate reports whether a module can be skipped:
+// same fingerprint and produces as its last build, and every produce still in the out dir.
+func (o *Orchestrator) upToDate(m *domain.Module) bool {
+	state := o.stateFor(m)
+	if state == nil || o.force {
+		return false
+	}
+
+	o.stateMu.Lock()
+	defer o.stateMu.Unlock()
+
+	if !state.UpToDate(m.Name, o.fingerprints[m.Name], m.Produces) {
+		return false
+	}
+
+	for _, produce := range m.Produces {
+		if _, err := os.Stat(filepath.Join(o.dirFor(m), produce)); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// record saves a successful build of m.
+// The state is saved after every module so an interrupted build keeps what was done.
+func (o *Orchestrator) record(m *domain.Module) error {
+	state := o.stateFor(m)
+	if state == nil {
+		return nil
+	}
+
+	o.stateMu.Lock()
+	defer o.stateMu.Unlock()
+
+	state.Record(m.Name, o.fingerprints[m.Name], m.Produces)
+	if err := o.store.Save(o.dirFor(m), state); err != nil {
+		return fmt.Errorf("saving build state: %w", err)
+	}
+	return nil
+}
+
+// forget drops m from the state so a failed build is never considered up to date
+func (o *Orchestrator) forget(m *domain.Module) {
+	state := o.stateFor(m)
+	if state == nil {
+		return
+	}
+
+	o.stateMu.Lock()
+	defer o.stateMu.Unlock()
+
+	state.Forget(m.Name)
+	// best effort, the build already failed
+	_ = o.store.Save(o.dirFor(m), state)
+}
+
+// restoreFromCache restores the produces of m from the artifact cache
+func (o *Orchestrator) restoreFromCache(m *domain.Module) (bool, error) {
+	if o.cache == nil || o.force {
+		return false, nil
+	}
+
+	restored, err := o.cache.Restore(o.fingerprints[m.Name], m.Produces, o.dirFor(m))
+	if err != nil {
+		return false, fmt.Errorf("restoring %s from cache: %w", m.Name, err)
+	}
+	return restored, nil
+}
+
+// cacheProduces stores the produces of a freshly built m.
+// A cache failure never fails the build.
+func (o *Orchestrator) cacheProduces(m *domain.Module) {
+	if o.cache == nil {
+		return
+	}
+
+	if err := o.cache.Store(o.fingerprints[m.Name], m.Produces, o.dirFor(m)); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: caching %s: %v\n", m.Name, err)
+	}
+}
@@ -0,0 +1,60 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/73NN0/foe-hammer/internal/orchestrator/domain"
+)
+
+// BuildMatrix plans and builds every target, each one into <out dir>/<target>/.
+// names are built with their depends, every module when empty.
+//
+// Modules are loaded once and resolved again for each target (see Plan).
+// A failing target doesn't stop the next ones, unless ctx is done.
+// Returns one report per target, in the given order, and ErrBuildFailed
+// listing the failed targets.
+// Requires: Load and SetOutput must be called first.
+func (o *Orchestrator) BuildMatrix(ctx context.Context, targets []domain.Target, names ...string) ([]domain.TargetReport, error) {
+	outDir := o.outDir
+	defer func() { o.outDir = outDir }()
+
+	reports := make([]domain.TargetReport, 0, len(targets))
+	var failed []string
+	for _, target := range targets {
+		if ctx.Err() != nil {
+			err := fmt.Errorf("%w: %w", ErrBuildCanceled, context.Cause(ctx))
+			reports = append(reports, domain.TargetReport{Target: target, Err: err})
+			failed = append(failed, target.String())
+			continue
+		}
+
+		fmt.Printf("==> %s\n", target)
+		o.outDir = filepath.Join(outDir, target.String())
+		o.report = nil
+
+		err := o.buildTarget(ctx, target, names)
+		reports = append(reports, domain.TargetReport{Target: target, Report: o.report, Err: err})
+		if err != nil {
+			failed = append(failed, target.String())
+		}
+	}
+
+	if len(failed) > 0 {
+		return reports, fmt.Errorf("%w for %s", ErrBuildFailed, strings.Join(failed, ", "))
+	}
+	return reports, nil
+}
+
+func (o *Orchestrator) buildTarget(ctx context.Context, target domain.Target, names []string) error {
+	if err := o.Plan(ctx, target); err != nil {
+		return fmt.Errorf("planning %s: %w", target, err)
+	}
+
+	if len(names) == 0 {
+		return o.BuildAll(ctx, target)
+	}
+	return o.BuildWithDeps(ctx, names, target)
+}
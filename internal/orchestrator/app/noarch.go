@@ -0,0 +1,95 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/73NN0/foe-hammer/internal/orchestrator/domain"
+)
+
+// noarch modules (arch=(any)) don't depend on the target:
+// they are built once for domain.AnyTarget into the shared noarch dir,
+// then their produces are linked into every target out dir.
+//
+//	bin/noarch/include/foo.h
+//	bin/amd64-linux/include/foo.h -> ../../noarch/include/foo.h
+//	bin/arm64-linux/include/foo.h -> ../../noarch/include/foo.h
+
+// dirFor returns the out dir m is built into
+func (o *Orchestrator) dirFor(m *domain.Module) string {
+	if m.NoArch() {
+		return o.noarchDir
+	}
+	return o.outDir
+}
+
+// stateFor returns the build state of the out dir m is built into
+func (o *Orchestrator) stateFor(m *domain.Module) *domain.BuildState {
+	if m.NoArch() {
+		return o.noarchState
+	}
+	return o.state
+}
+
+// checkNoArch makes sure noarch modules only depend on noarch modules,
+// a noarch module built against a target specific one would not be the same for every target.
+func checkNoArch(graph *domain.ModuleGraph) error {
+	for _, m := range graph.All() {
+		if !m.NoArch() {
+			continue
+		}
+		for _, name := range m.Depends {
+			// a host tool is only run, not shipped
+			if slices.Contains(m.HostDepends, name) {
+				continue
+			}
+			dep, err := graph.Get(name)
+			if err != nil {
+				return err
+			}
+			if !dep.NoArch() {
+				return fmt.Errorf("%s is arch=(any) but depends on %s, which is built per target", m.Name, name)
+			}
+		}
+	}
+	return nil
+}
+
+// sharedNoArch reports whether m was already built for another target during this run
+func (o *Orchestrator) sharedNoArch(m *domain.Module) bool {
+	o.stateMu.Lock()
+	defer o.stateMu.Unlock()
+	return o.noarchDone[m.Name]
+}
+
+// shareNoArch links the produces of the noarch module m into the target out dir
+func (o *Orchestrator) shareNoArch(m *domain.Module) error {
+	for _, produce := range m.Produces {
+		src := filepath.Join(o.noarchDir, produce)
+		dst := filepath.Join(o.outDir, produce)
+
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return fmt.Errorf("sharing %s: %w", m.Name, err)
+		}
+		rel, err := filepath.Rel(filepath.Dir(dst), src)
+		if err != nil {
+			return fmt.Errorf("sharing %s: %w", m.Name, err)
+		}
+		if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("sharing %s: %w", m.Name, err)
+		}
+		if err := os.Symlink(rel, dst); err != nil {
+			return fmt.Errorf("sharing %s: %w", m.Name, err)
+		}
+	}
+
+	o.stateMu.Lock()
+	defer o.stateMu.Unlock()
+	if o.noarchDone == nil {
+		o.noarchDone = make(map[string]bool)
+	}
+	o.noarchDone[m.Name] = true
+	return nil
+}
@@ -1,26 +1,45 @@
 package app
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/73NN0/foe-hammer/internal/orchestrator/domain"
 )
 
-// ContextProvider builds the environment variables for hook execution
+var (
+	ErrBuildFailed   = errors.New("build failed")
+	ErrHookTimedOut  = errors.New("hook timed out")
+	ErrBuildCanceled = errors.New("build canceled")
+
+	ErrArtifactNotProduced = errors.New("build() did not produce its artifacts")
+)
+
+// ContextProvider builds the environment variables for hook execution.
+// deps are the transitive depends of module in build order, with their Exports resolved.
 type ContextProvider interface {
-	BuildEnv(host domain.Host, target domain.Target, module *domain.Module, outDir string) map[string]string
+	BuildEnv(host domain.Host, target domain.Target, module *domain.Module, outDir string, deps []*domain.Module) map[string]string
 }
 
 type Executor interface {
 	Run(cmd string, args []string, workDir string, stdout, stderr io.Writer) error
 }
 
-// HookRunner executes the build hook of a module
+// HookRunner executes the build hook of a module.
+// When ctx is done the hook and every process it started must be stopped.
 type HookRunner interface {
-	Run(module *domain.Module, env map[string]string) error
-	Produces(module *domain.Module, env map[string]string) ([]string, error)
+	Run(ctx context.Context, module *domain.Module, env map[string]string) error
+	Produces(ctx context.Context, module *domain.Module, env map[string]string) ([]string, error)
+	// Exports runs the optional exports() hook, KEY=VALUE given to the dependents
+	Exports(ctx context.Context, module *domain.Module, env map[string]string) (map[string]string, error)
 }
 
 type ModuleLoader interface {
@@ -28,6 +47,20 @@ type ModuleLoader interface {
 	Load(path string) (*domain.Module, error)
 }
 
+// StateStore persists the build state of an out dir between runs
+type StateStore interface {
+	Load(outDir string) (*domain.BuildState, error)
+	Save(outDir string, state *domain.BuildState) error
+}
+
+// ArtifactCache stores the produces of modules by fingerprint,
+// so identical modules are not rebuilt across out dirs or branches
+type ArtifactCache interface {
+	// Restore copies the cached produces into outDir, false on a cache miss
+	Restore(key string, produces []string, outDir string) (bool, error)
+	Store(key string, produces []string, outDir string) error
+}
+
 // ToolChecker vérifie que les outils externes sont disponibles
 type ToolChecker interface {
 	// Check retourne nil si l'outil est disponible, une erreur sinon
@@ -44,17 +77,52 @@ type ToolChecker interface {
 //	o := app.NewOrchestrator(loader, context, runner, host, checker)
 //	o.Load("./project")
 //	o.SetOutput("./build")
-//	o.Plan(target)
-//	o.BuildAll(target)
+//	o.SetJobs(4)
+//	o.SetStateStore(store) // optional, enables incremental builds
+//	o.SetCache(cache)      // optional, restores artifacts instead of building
+//	o.Plan(ctx, target)
+//	o.BuildAll(ctx, target)
 type Orchestrator struct {
-	loader  ModuleLoader
-	context ContextProvider
-	runner  HookRunner
-	checker ToolChecker // CanBuild
-	host    domain.Host
-	graph   *domain.ModuleGraph
-	rootDir string
-	outDir  string
+	loader   ModuleLoader
+	context  ContextProvider
+	runner   HookRunner
+	checker  ToolChecker // CanBuild
+	host     domain.Host
+	modules  []*domain.Module // as loaded, before resolve
+	graph    *domain.ModuleGraph
+	excluded []domain.Excluded // modules not supporting the planned target
+	rootDir  string
+	outDir   string
+	jobs     int // max hooks running at once
+
+	// incremental builds, see SetStateStore
+	store        StateStore
+	force        bool
+	stateMu      sync.Mutex
+	state        *domain.BuildState
+	fingerprints map[string]string
+	cache        ArtifactCache
+
+	// arch=(any) modules, see noarch.go
+	noarchDir   string
+	noarchState *domain.BuildState
+	noarchDone  map[string]bool // shared during this run
+
+	// hostdepends=() modules, see host.go
+	hostDir   string
+	hostBuild *Orchestrator // nil unless cross compiling with host tools
+
+	keepGoing bool
+	report    *domain.BuildReport
+	timeout   time.Duration // default per-module timeout, 0 = none
+
+	warnUndeclared  bool
+	sourceCheck     bool // see sources.go
+	staging         bool // see staging.go
+	strictSources   bool
+	artifacts       *domain.ArtifactIndex
+	providers       domain.ProviderSelection
+	targetProviders map[domain.Target]domain.ProviderSelection
 }
 
 func NewOrchestrator(
@@ -70,18 +138,90 @@ func NewOrchestrator(
 		runner:  runner,
 		host:    host,
 		checker: checker,
+		jobs:    1,
+	}
+}
+
+// SelectProviders chooses which module provides each virtual name (PKGBUILD provides=).
+// A virtual name with a single provider doesn't need to be selected.
+// Must be called before Load, or before Plan to change it for another target.
+func (o *Orchestrator) SelectProviders(sel domain.ProviderSelection) {
+	o.providers = sel
+}
+
+// SelectTargetProviders overrides SelectProviders when building for target.
+func (o *Orchestrator) SelectTargetProviders(target domain.Target, sel domain.ProviderSelection) {
+	if o.targetProviders == nil {
+		o.targetProviders = make(map[domain.Target]domain.ProviderSelection)
 	}
+	o.targetProviders[target] = sel
 }
 
-// Load scans rootDir for modules, builds the dependency graph,
-// validates dependencies, and computes the topological order.
+// Load scans rootDir for modules and resolves them for a native build (target = host), see resolve.
+// Plan resolves them again when building for another target.
 func (o *Orchestrator) Load(rootDir string) error {
+	return o.LoadFor(rootDir, o.host.Target())
+}
+
+// LoadFor is Load resolving the modules for target,
+// so a cross build doesn't fail on modules the host doesn't support.
+func (o *Orchestrator) LoadFor(rootDir string, target domain.Target) error {
 	// 1. Load all modules
 	modules, err := o.loader.LoadAll(rootDir)
 	if err != nil {
 		return fmt.Errorf("loading modules: %w", err)
 	}
 
+	o.rootDir = rootDir
+	o.modules = modules
+	o.noarchDone = nil
+
+	return o.resolve(target)
+}
+
+// resolve builds the dependency graph of the loaded modules for target:
+// excludes the modules not supporting target, merges the target-conditional arrays,
+// resolves virtual dependencies, validates dependencies, and computes the topological order.
+func (o *Orchestrator) resolve(target domain.Target) error {
+	// 0. arch=() os=()
+	supported, excluded := domain.FilterSupported(o.modules, target)
+
+	// 1. depends_linux=() etc...
+	modules := make([]*domain.Module, 0, len(supported))
+	for _, m := range supported {
+		forTarget := target
+		if m.NoArch() {
+			forTarget = domain.AnyTarget
+		}
+		r := m.ForTarget(forTarget)
+		if !o.host.CrossCompilingTo(target) {
+			// native build, host tools are built along the other modules
+			for _, tool := range r.HostDepends {
+				if !slices.Contains(r.Depends, tool) {
+					r.Depends = append(r.Depends, tool)
+				}
+			}
+		}
+		modules = append(modules, r)
+	}
+
+	// 1.5 depends=(platform) -> the chosen provider, other providers are dropped
+	providers := o.providers
+	if sel, ok := o.targetProviders[target]; ok {
+		providers = sel
+	}
+	// an excluded provider tells why, not only that it isn't there
+	if err := domain.CheckSelectedProviders(providers, excluded, target); err != nil {
+		return fmt.Errorf("resolving providers: %w", err)
+	}
+	modules, err := domain.ResolveProviders(modules, providers)
+	if err != nil {
+		return fmt.Errorf("resolving providers: %w", err)
+	}
+	if err := domain.CheckExcluded(modules, excluded, target); err != nil {
+		return fmt.Errorf("validation: %w", err)
+	}
+
 	// 2. Build the graph
 	graph := domain.NewModuleGraph()
 	for _, m := range modules {
@@ -95,17 +235,24 @@ func (o *Orchestrator) Load(rootDir string) error {
 		return fmt.Errorf("validation: %w", err)
 	}
 
+	if err := checkNoArch(graph); err != nil {
+		return fmt.Errorf("validation: %w", err)
+	}
+
 	// 4. Topo sort
 	if err := graph.TopoSort(); err != nil {
 		return err
 	}
 
 	o.graph = graph
+	o.excluded = excluded
 
 	return nil
 }
 
 // SetOutput sets the output directory for build artifacts.
+// noarch modules (arch=(any)) are built into <outDir>/noarch and linked from there,
+// host tools of cross builds (hostdepends=()) into <outDir>/host.
 // Must be called before Plan.
 func (o *Orchestrator) SetOutput(outDir string) error {
 	absPath, err := filepath.Abs(outDir)
@@ -113,15 +260,107 @@ func (o *Orchestrator) SetOutput(outDir string) error {
 		return err
 	}
 	o.outDir = absPath
+	o.noarchDir = filepath.Join(absPath, "noarch")
+	o.hostDir = filepath.Join(absPath, "host")
 	return nil
 }
 
+// Close releases what the loader and the runner hold (bash workers...), when they do
+func (o *Orchestrator) Close() error {
+	var errs []error
+	for _, port := range []any{o.loader, o.runner} {
+		if c, ok := port.(io.Closer); ok {
+			errs = append(errs, c.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SetJobs sets how many modules can be built at the same time.
+// n <= 0 means one job per CPU.
+func (o *Orchestrator) SetJobs(n int) {
+	if n <= 0 {
+		n = runtime.NumCPU()
+	}
+	o.jobs = n
+}
+
+// SetStateStore enables incremental builds:
+// modules whose inputs didn't change since their last successful build are skipped.
+// Must be called before Plan.
+func (o *Orchestrator) SetStateStore(store StateStore) {
+	o.store = store
+}
+
+// SetCache enables the artifact cache:
+// a module whose fingerprint is cached gets its produces restored instead of being built.
+// Must be called before Plan.
+func (o *Orchestrator) SetCache(cache ArtifactCache) {
+	o.cache = cache
+}
+
+// SetKeepGoing keeps building every module not downstream of a failure,
+// instead of stopping at the first failing module.
+// Dependents of failed modules are skipped, see Report.
+func (o *Orchestrator) SetKeepGoing(keepGoing bool) {
+	o.keepGoing = keepGoing
+}
+
+// Report returns what happened to each module during the last BuildAll or BuildFrom.
+func (o *Orchestrator) Report() *domain.BuildReport {
+	return o.report
+}
+
+// SetTimeout sets how long a build hook may run before being killed.
+// A module's own timeout (PKGBUILD timeout=) takes precedence. 0 means no timeout.
+func (o *Orchestrator) SetTimeout(timeout time.Duration) {
+	o.timeout = timeout
+}
+
+// SetWarnUndeclared warns about files written next to a module's produces
+// that no module declares.
+func (o *Orchestrator) SetWarnUndeclared(warn bool) {
+	o.warnUndeclared = warn
+}
+
+// SetCheckSources warns about files build() creates, modifies or deletes in the modules dirs,
+// e.g. objects written next to the sources instead of $FOE_OUTDIR.
+func (o *Orchestrator) SetCheckSources(check bool) {
+	o.sourceCheck = check
+}
+
+// SetStrictSources makes a build() writing into the modules dirs fail, see SetCheckSources.
+func (o *Orchestrator) SetStrictSources(strict bool) {
+	o.strictSources = strict
+	if strict {
+		o.sourceCheck = true
+	}
+}
+
+// SetForce rebuilds every module even if it is up to date.
+// The build state is still recorded.
+func (o *Orchestrator) SetForce(force bool) {
+	o.force = force
+}
+
 // All returns all loaded modules directly from the internal graph so there is no topoligical order.
 // Requires: Load must be called first.
 func (o *Orchestrator) All() []*domain.Module {
 	return o.graph.All()
 }
 
+// Module returns a module as resolved for the planned target.
+// Requires: Load must be called first.
+func (o *Orchestrator) Module(name string) (*domain.Module, error) {
+	return o.graph.Get(name)
+}
+
+// Excluded returns the modules left out of the graph because they don't support the target.
+// Requires: Load must be called first, it changes with the target given to Plan.
+func (o *Orchestrator) Excluded() []domain.Excluded {
+	return o.excluded
+}
+
 // Order returns the topological build order.
 // Order result is not deterministic (flemme)
 // Requires: Load must be called first.
@@ -129,6 +368,20 @@ func (o *Orchestrator) Order() []string {
 	return o.graph.Order()
 }
 
+// Owner returns the module producing path.
+// path is relative to the out dir, or absolute inside it.
+// Requires: Plan must be called first.
+func (o *Orchestrator) Owner(path string) (*domain.Module, error) {
+	if filepath.IsAbs(path) {
+		rel, err := filepath.Rel(o.outDir, path)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			return nil, fmt.Errorf("%s is not inside the out dir %s", path, o.outDir)
+		}
+		path = rel
+	}
+	return o.artifacts.Owner(path)
+}
+
 // CanBuild checks if all external tools (makedepends) are available for a module.
 // Module dependencies check is assured by the graph construction when loading the orchestrator
 func (o *Orchestrator) CanBuild(name string) error {
@@ -148,72 +401,230 @@ func (o *Orchestrator) CanBuild(name string) error {
 
 // Build builds a single module.
 // Requires: Plan must be called first.
-func (o *Orchestrator) Build(name string, target domain.Target) error {
-	fmt.Printf("DEBUG: outDir = %q\n", o.outDir)
+func (o *Orchestrator) Build(ctx context.Context, name string, target domain.Target) error {
+	_, err := o.build(ctx, name, target)
+	return err
+}
+
+// build builds a single module and tells how it was done
+func (o *Orchestrator) build(ctx context.Context, name string, target domain.Target) (domain.BuildStatus, error) {
 	m, err := o.graph.Get(name)
 	if err != nil {
-		return err
+		return domain.BuildStatusFailed, err
+	}
+
+	if !m.NoArch() {
+		return o.buildModule(ctx, m, target)
+	}
+
+	if o.sharedNoArch(m) {
+		fmt.Printf("%s is shared with another target\n", name)
+		return domain.BuildStatusUpToDate, o.shareNoArch(m)
+	}
+	// envFor builds it for domain.AnyTarget, with the host tools of target
+	status, err := o.buildModule(ctx, m, target)
+	if err != nil {
+		return status, err
+	}
+	return status, o.shareNoArch(m)
+}
+
+func (o *Orchestrator) buildModule(ctx context.Context, m *domain.Module, target domain.Target) (domain.BuildStatus, error) {
+	name := m.Name
+	if o.upToDate(m) {
+		fmt.Printf("%s is up to date\n", name)
+		return domain.BuildStatusUpToDate, nil
+	}
+
+	if restored, err := o.restoreFromCache(m); err != nil {
+		return domain.BuildStatusFailed, err
+	} else if restored {
+		fmt.Printf("%s restored from cache\n", name)
+		return domain.BuildStatusCached, o.record(m)
 	}
 
 	// verify tools
 	if err := o.CanBuild(name); err != nil {
-		return err
+		return domain.BuildStatusFailed, err
 	}
 
 	// prepare env
-	env := o.context.BuildEnv(o.host, target, m, o.outDir)
+	env := o.envFor(m, target)
+
+	if o.staging {
+		if err := o.stageSysroot(m); err != nil {
+			return domain.BuildStatusFailed, err
+		}
+	}
+
+	var sources sourceSnapshot
+	if o.sourceCheck {
+		sources = o.snapshotSources()
+	}
 
 	// execute hook
-	if err := o.runner.Run(m, env); err != nil {
-		return fmt.Errorf("building %s: %w", name, err)
+	start := time.Now()
+	if err := o.runHook(ctx, m, env); err != nil {
+		o.forget(m)
+		return domain.BuildStatusFailed, fmt.Errorf("building %s: %w", name, err)
 	}
 
-	return nil
+	if o.sourceCheck {
+		if err := o.checkSources(m, sources); err != nil {
+			o.forget(m)
+			return domain.BuildStatusFailed, fmt.Errorf("building %s: %w", name, err)
+		}
+	}
+
+	// exit 0 is not enough, the module must deliver what it declared
+	if err := o.verifyProduces(m, start); err != nil {
+		o.forget(m)
+		return domain.BuildStatusFailed, fmt.Errorf("building %s: %w", name, err)
+	}
+	if o.warnUndeclared {
+		o.reportUndeclared(m, start)
+	}
+
+	o.cacheProduces(m)
+	return domain.BuildStatusBuilt, o.record(m)
 }
 
-// BuildFrom builds a module and all its descendants (modules that depend on it).
-// Requires: Plan must be called first.
-func (o *Orchestrator) BuildFrom(name string, target domain.Target) error {
-	// Descendants retourne [name, ...ceux qui dépendent de name] dans l'ordre topo
-	toBuild := o.graph.Descendants(name)
+// runHook runs the build hook of m, killing it after its timeout.
+func (o *Orchestrator) runHook(ctx context.Context, m *domain.Module, env map[string]string) error {
+	timeout := o.timeout
+	if m.Timeout > 0 {
+		timeout = m.Timeout
+	}
 
-	for _, modName := range toBuild {
-		fmt.Printf("Building %s...\n", modName)
-		if err := o.Build(modName, target); err != nil {
-			return err
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, timeout, fmt.Errorf("%w after %s", ErrHookTimedOut, timeout))
+		defer cancel()
+	}
+
+	err := o.runner.Run(ctx, m, env)
+	if err != nil && ctx.Err() != nil {
+		// the hook was killed, say why instead of "signal: terminated"
+		return context.Cause(ctx)
+	}
+	return err
+}
+
+// depsOf returns the transitive depends of m in build order
+func (o *Orchestrator) depsOf(m *domain.Module) []*domain.Module {
+	names := o.graph.Ancestors(m.Name)
+	deps := make([]*domain.Module, 0, len(names))
+	for _, name := range names {
+		if name == m.Name {
+			continue
+		}
+		if dep, err := o.graph.Get(name); err == nil {
+			deps = append(deps, dep)
 		}
 	}
+	return deps
+}
 
-	return nil
+// envFor returns the env of m's hooks
+func (o *Orchestrator) envFor(m *domain.Module, target domain.Target) map[string]string {
+	// the host tools of a noarch module are built along target, see resolve
+	hostBinDir := o.hostBinDir(target)
+	if m.NoArch() {
+		target = domain.AnyTarget
+	}
+	env := o.context.BuildEnv(o.host, target, m, o.dirFor(m), o.depsOf(m))
+	if o.staging {
+		if sysroot, ok := env["FOE_SYSROOT"]; ok {
+			env["FOE_TOOLCHAIN_SYSROOT"] = sysroot
+		}
+		env["FOE_SYSROOT"] = o.stagingDir(m)
+	}
+	if len(m.HostDepends) > 0 {
+		env["FOE_HOST_BINDIR"] = hostBinDir
+	}
+	return env
 }
 
-// BuildAll builds all modules in topological order.
+// BuildFrom builds a module and all its descendants (modules that depend on it).
+// Independent modules are built in parallel, see SetJobs.
 // Requires: Plan must be called first.
-func (o *Orchestrator) BuildAll(target domain.Target) error {
-	order := o.graph.Order()
+func (o *Orchestrator) BuildFrom(ctx context.Context, name string, target domain.Target) error {
+	if _, err := o.graph.Get(name); err != nil {
+		return err
+	}
+
+	// Descendants retourne [name, ...ceux qui dépendent de name] dans l'ordre topo
+	return o.schedule(ctx, o.graph.Descendants(name), target)
+}
 
-	for _, name := range order {
-		fmt.Printf("Building %s...\n", name)
-		if err := o.Build(name, target); err != nil {
+// BuildWithDeps builds the named modules and their transitive depends, nothing else.
+// Independent modules are built in parallel, see SetJobs.
+// Requires: Plan must be called first.
+func (o *Orchestrator) BuildWithDeps(ctx context.Context, names []string, target domain.Target) error {
+	for _, name := range names {
+		if _, err := o.graph.Get(name); err != nil {
 			return err
 		}
 	}
 
-	return nil
+	return o.schedule(ctx, o.graph.Ancestors(names...), target)
 }
 
-// Plan resolves what each module will produce for the given target.
+// BuildAll builds all modules, each one as soon as all its depends are built.
+// Independent modules are built in parallel, see SetJobs.
+// Requires: Plan must be called first.
+func (o *Orchestrator) BuildAll(ctx context.Context, target domain.Target) error {
+	return o.schedule(ctx, o.graph.Order(), target)
+}
+
+// Plan resolves the graph for the given target and what each module will produce.
 // Must be called after Load and SetOutput, and before any Build method.
-func (o *Orchestrator) Plan(target domain.Target) error {
-	for _, m := range o.graph.All() {
-		env := o.context.BuildEnv(o.host, target, m, o.outDir)
+func (o *Orchestrator) Plan(ctx context.Context, target domain.Target) error {
+	// the graph depends on the target (depends_linux=()...) and the selected providers
+	if err := o.resolve(target); err != nil {
+		return fmt.Errorf("resolving modules for %s: %w", target, err)
+	}
 
-		produces, err := o.runner.Produces(m, env)
+	// in build order, the env of a module has the exports of its depends
+	for _, name := range o.graph.Order() {
+		m, err := o.graph.Get(name)
 		if err != nil {
-			return fmt.Errorf("resolving produces for %s: %w", m.Name, err)
+			return err
 		}
+		env := o.envFor(m, target)
 
+		produces, err := o.runner.Produces(ctx, m, env)
+		if err != nil {
+			return fmt.Errorf("resolving produces for %s: %w", m.Name, err)
+		}
 		m.Produces = produces
+
+		if m.HasHook("exports") {
+			exports, err := o.runner.Exports(ctx, m, env)
+			if err != nil {
+				return fmt.Errorf("resolving exports for %s: %w", m.Name, err)
+			}
+			m.Exports = exports
+		}
 	}
-	return nil
+
+	// hostdepends=() of a cross build
+	if err := o.planHost(ctx, target); err != nil {
+		return err
+	}
+
+	// two modules writing the same file: whichever builds last would silently win
+	artifacts, err := domain.NewArtifactIndex(o.graph.All())
+	if err != nil {
+		return err
+	}
+	o.artifacts = artifacts
+
+	if o.store == nil && o.cache == nil {
+		return nil
+	}
+	if err := o.fingerprintAll(target); err != nil {
+		return err
+	}
+	return o.loadState()
 }
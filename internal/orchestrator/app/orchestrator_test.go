@@ -1,12 +1,21 @@
 package app_test
 
 import (
+	"context"
+	"errors"
+	"io"
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
-	"github.com/73NN0/foe-hammer/internal/orchestrator/adapters/context"
+	bashpool "github.com/73NN0/foe-hammer/internal/orchestrator/adapters/bash-pool"
+	buildstate "github.com/73NN0/foe-hammer/internal/orchestrator/adapters/build-state"
+	envcontext "github.com/73NN0/foe-hammer/internal/orchestrator/adapters/context"
 	hookrunner "github.com/73NN0/foe-hammer/internal/orchestrator/adapters/hook-runner"
 	moduleloader "github.com/73NN0/foe-hammer/internal/orchestrator/adapters/module-loader"
 	"github.com/73NN0/foe-hammer/internal/orchestrator/adapters/toolchecker"
@@ -33,6 +42,7 @@ func TestOrchestrator(t *testing.T) {
 	tests := []struct {
 		name         string
 		rootDir      string
+		providers    domain.ProviderSelection
 		wantLoadErr  bool
 		wantPlanErr  bool
 		wantBuildErr bool
@@ -66,16 +76,26 @@ func TestOrchestrator(t *testing.T) {
 			wantLoadErr: true,
 		},
 		{
-			name:    "plan9 - platform abstraction",
-			rootDir: plan9Path,
+			name:      "plan9 - platform abstraction",
+			rootDir:   plan9Path,
+			providers: domain.ProviderSelection{"platform": "platform-unix"},
 			checkOrder: func(t *testing.T, order []string) {
 				// app should be last
 				last := order[len(order)-1]
 				if last != "app" {
 					t.Errorf("expected app last, got %s", last)
 				}
+				// platform-stub is an alternative that was not chosen
+				if slices.Contains(order, "platform-stub") {
+					t.Errorf("expected platform-stub to be dropped, got %v", order)
+				}
 			},
 		},
+		{
+			name:        "plan9 - ambiguous platform provider",
+			rootDir:     plan9Path,
+			wantLoadErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -84,11 +104,12 @@ func TestOrchestrator(t *testing.T) {
 
 			orchestrator := orchestrator.NewOrchestrator(
 				moduleloader.NewBashLoader(),
-				context.NewEnvProvider(),
+				envcontext.NewEnvProvider(),
 				hookrunner.NewBashHookRunner(),
 				host,
 				toolchecker.NewWhichChecker(),
 			)
+			orchestrator.SelectProviders(tt.providers)
 
 			// Load
 			err := orchestrator.Load(tt.rootDir)
@@ -110,7 +131,7 @@ func TestOrchestrator(t *testing.T) {
 			// Plan
 			orchestrator.SetOutput(outDir)
 			t.Logf("outDir = %s", outDir)
-			err = orchestrator.Plan(target)
+			err = orchestrator.Plan(context.Background(), target)
 			if tt.wantPlanErr {
 				if err == nil {
 					t.Fatal("expected Plan error, got nil")
@@ -123,7 +144,7 @@ func TestOrchestrator(t *testing.T) {
 
 			// Build (optionnel selon le test)
 			if tt.checkBuild != nil {
-				err = orchestrator.BuildAll(target)
+				err = orchestrator.BuildAll(context.Background(), target)
 				if tt.wantBuildErr {
 					if err == nil {
 						t.Fatal("expected BuildAll error, got nil")
@@ -143,3 +164,891 @@ func TestOrchestrator(t *testing.T) {
 func TestPlan(t *testing.T) {
 
 }
+
+// fakes
+
+type fakeLoader struct {
+	modules []*domain.Module
+}
+
+func (l *fakeLoader) LoadAll(rootDir string) ([]*domain.Module, error) { return l.modules, nil }
+func (l *fakeLoader) Load(path string) (*domain.Module, error)         { return nil, nil }
+
+type fakeChecker struct{}
+
+func (c fakeChecker) Check(tool string) error                      { return nil }
+func (c fakeChecker) Suggest(tool string, host domain.Host) string { return "" }
+
+// fakeRunner records the order in which hooks finish and how many run at once
+type fakeRunner struct {
+	mu       sync.Mutex
+	running  int
+	maxSeen  int
+	finished []string
+	fail     map[string]error
+}
+
+func (r *fakeRunner) Run(ctx context.Context, module *domain.Module, env map[string]string) error {
+	r.mu.Lock()
+	r.running++
+	if r.running > r.maxSeen {
+		r.maxSeen = r.running
+	}
+	r.mu.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.running--
+	r.finished = append(r.finished, module.Name)
+	return r.fail[module.Name]
+}
+
+func (r *fakeRunner) Produces(ctx context.Context, module *domain.Module, env map[string]string) ([]string, error) {
+	return nil, nil
+}
+
+func (r *fakeRunner) Exports(ctx context.Context, module *domain.Module, env map[string]string) (map[string]string, error) {
+	return nil, nil
+}
+
+func newFakeOrchestrator(t *testing.T, runner *fakeRunner, modules ...*domain.Module) *orchestrator.Orchestrator {
+	t.Helper()
+	o := orchestrator.NewOrchestrator(
+		&fakeLoader{modules: modules},
+		envcontext.NewEnvProvider(),
+		runner,
+		domain.NewHost(),
+		fakeChecker{},
+	)
+	if err := o.Load("."); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	o.SetOutput(t.TempDir())
+	return o
+}
+
+func TestBuildAllParallel(t *testing.T) {
+	target := domain.NewTarget()
+
+	//  liba ─┐
+	//  libb ─┼─→ app
+	//  libc ─┘
+	modules := func() []*domain.Module {
+		return []*domain.Module{
+			{Name: "liba"},
+			{Name: "libb"},
+			{Name: "libc"},
+			{Name: "app", Depends: []string{"liba", "libb", "libc"}},
+		}
+	}
+
+	tests := []struct {
+		name        string
+		jobs        int
+		wantMaxSeen int
+	}{
+		{name: "sequential", jobs: 1, wantMaxSeen: 1},
+		{name: "two jobs", jobs: 2, wantMaxSeen: 2},
+		{name: "leaves at once", jobs: 8, wantMaxSeen: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := &fakeRunner{}
+			o := newFakeOrchestrator(t, runner, modules()...)
+			o.SetJobs(tt.jobs)
+
+			if err := o.BuildAll(context.Background(), target); err != nil {
+				t.Fatalf("BuildAll: %v", err)
+			}
+
+			if runner.maxSeen != tt.wantMaxSeen {
+				t.Errorf("expected %d hooks at once, got %d", tt.wantMaxSeen, runner.maxSeen)
+			}
+			if len(runner.finished) != 4 || runner.finished[3] != "app" {
+				t.Errorf("expected app to be built last, got %v", runner.finished)
+			}
+		})
+	}
+}
+
+func TestBuildAllParallelStopsOnFailure(t *testing.T) {
+	runner := &fakeRunner{fail: map[string]error{"liba": os.ErrInvalid}}
+	o := newFakeOrchestrator(t, runner,
+		&domain.Module{Name: "liba"},
+		&domain.Module{Name: "libb", Depends: []string{"liba"}},
+		&domain.Module{Name: "app", Depends: []string{"libb"}},
+	)
+	o.SetJobs(4)
+
+	if err := o.BuildAll(context.Background(), domain.NewTarget()); err == nil {
+		t.Fatal("expected BuildAll error, got nil")
+	}
+
+	if len(runner.finished) != 1 {
+		t.Errorf("expected only liba to run, got %v", runner.finished)
+	}
+}
+
+// countingRunner runs the real hooks and records which modules were built
+type countingRunner struct {
+	*hookrunner.BashHookRunner
+	mu    sync.Mutex
+	built []string
+}
+
+func (r *countingRunner) Run(ctx context.Context, module *domain.Module, env map[string]string) error {
+	r.mu.Lock()
+	r.built = append(r.built, module.Name)
+	r.mu.Unlock()
+	return r.BashHookRunner.Run(ctx, module, env)
+}
+
+func TestIncrementalBuild(t *testing.T) {
+	rootDir := t.TempDir()
+	if err := os.CopyFS(rootDir, os.DirFS(simplePath)); err != nil {
+		t.Fatal(err)
+	}
+	outDir := t.TempDir()
+	build := func() []string { return buildIncremental(t, rootDir, outDir) }
+
+	if got := build(); !slices.Equal(got, []string{"app", "liba", "libb"}) {
+		t.Fatalf("first build: expected every module to be built, got %v", got)
+	}
+
+	if got := build(); len(got) != 0 {
+		t.Fatalf("second build: expected nothing to be built, got %v", got)
+	}
+
+	// a one line change in libb rebuilds libb and its descendants only
+	src := filepath.Join(rootDir, "libb", "b.c")
+	f, err := os.OpenFile(src, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("\n// touched\n")
+	f.Close()
+
+	if got := build(); !slices.Equal(got, []string{"app", "libb"}) {
+		t.Fatalf("after editing libb: expected libb and app to be rebuilt, got %v", got)
+	}
+}
+
+// buildIncremental builds rootDir into outDir with a state store and returns the modules built, sorted
+func buildIncremental(t *testing.T, rootDir, outDir string) []string {
+	t.Helper()
+	target := domain.NewTarget()
+	runner := &countingRunner{BashHookRunner: hookrunner.NewBashHookRunner()}
+	o := orchestrator.NewOrchestrator(
+		moduleloader.NewBashLoader(),
+		envcontext.NewEnvProvider(),
+		runner,
+		domain.NewHost(),
+		toolchecker.NewWhichChecker(),
+	)
+	if err := o.Load(rootDir); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	o.SetOutput(outDir)
+	o.SetStateStore(buildstate.NewJSONStore())
+	if err := o.Plan(context.Background(), target); err != nil {
+		t.Fatalf("Plan: %v", err)
+	}
+	if err := o.BuildAll(context.Background(), target); err != nil {
+		t.Fatalf("BuildAll: %v", err)
+	}
+	slices.Sort(runner.built)
+	return runner.built
+}
+
+func TestIncrementalSourceDir(t *testing.T) {
+	rootDir := t.TempDir()
+	writePKGBUILD(t, rootDir, "mod", `pkgname=mod
+pkgdesc="Sources in a dir"
+source=(src)
+produces() { echo lib/libmod.a; }
+build() { mkdir -p "$FOE_LIBDIR" && cat src/sub/*.c > "$FOE_LIBDIR/libmod.a"; }
+`)
+	srcDir := filepath.Join(rootDir, "mod", "src", "sub")
+	if err := os.MkdirAll(srcDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(srcDir, "a.c"), []byte("int a;\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	outDir := t.TempDir()
+
+	if got := buildIncremental(t, rootDir, outDir); !slices.Equal(got, []string{"mod"}) {
+		t.Fatalf("first build: expected mod to be built, got %v", got)
+	}
+	if got := buildIncremental(t, rootDir, outDir); len(got) != 0 {
+		t.Fatalf("second build: expected nothing to be built, got %v", got)
+	}
+
+	// a file deep in the dir counts
+	if err := os.WriteFile(filepath.Join(srcDir, "a.c"), []byte("int a = 1;\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := buildIncremental(t, rootDir, outDir); !slices.Equal(got, []string{"mod"}) {
+		t.Fatalf("after editing src/sub/a.c: expected mod to be rebuilt, got %v", got)
+	}
+}
+
+func TestIncrementalMissingSource(t *testing.T) {
+	rootDir := t.TempDir()
+	writePKGBUILD(t, rootDir, "mod", `pkgname=mod
+pkgdesc="Source generated later"
+source=(PKGBUILD gen.h)
+produces() { echo lib/libmod.a; }
+build() { mkdir -p "$FOE_LIBDIR" && echo mod > "$FOE_LIBDIR/libmod.a"; }
+`)
+	outDir := t.TempDir()
+
+	if got := buildIncremental(t, rootDir, outDir); !slices.Equal(got, []string{"mod"}) {
+		t.Fatalf("first build: expected mod to be built, got %v", got)
+	}
+	if got := buildIncremental(t, rootDir, outDir); len(got) != 0 {
+		t.Fatalf("second build: expected nothing to be built, got %v", got)
+	}
+
+	// once generated, it is an input like the others
+	if err := os.WriteFile(filepath.Join(rootDir, "mod", "gen.h"), []byte("#define GEN 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := buildIncremental(t, rootDir, outDir); !slices.Equal(got, []string{"mod"}) {
+		t.Fatalf("after generating gen.h: expected mod to be rebuilt, got %v", got)
+	}
+}
+
+func TestBuildAllKeepGoing(t *testing.T) {
+	// liba ──→ libb ──→ app
+	// libc ──→ tool
+	runner := &fakeRunner{fail: map[string]error{"liba": os.ErrInvalid}}
+	o := newFakeOrchestrator(t, runner,
+		&domain.Module{Name: "liba"},
+		&domain.Module{Name: "libb", Depends: []string{"liba"}},
+		&domain.Module{Name: "app", Depends: []string{"libb"}},
+		&domain.Module{Name: "libc"},
+		&domain.Module{Name: "tool", Depends: []string{"libc"}},
+	)
+	o.SetJobs(2)
+	o.SetKeepGoing(true)
+
+	err := o.BuildAll(context.Background(), domain.NewTarget())
+	if !errors.Is(err, orchestrator.ErrBuildFailed) {
+		t.Fatalf("expected ErrBuildFailed, got %v", err)
+	}
+
+	want := map[string]domain.BuildStatus{
+		"liba": domain.BuildStatusFailed,
+		"libb": domain.BuildStatusSkipped,
+		"app":  domain.BuildStatusSkipped,
+		"libc": domain.BuildStatusBuilt,
+		"tool": domain.BuildStatusBuilt,
+	}
+
+	report := o.Report()
+	if len(report.Results) != len(want) {
+		t.Fatalf("expected %d results, got %+v", len(want), report.Results)
+	}
+	for _, r := range report.Results {
+		if r.Status != want[r.Name] {
+			t.Errorf("%s: expected %s, got %s (%v)", r.Name, want[r.Name], r.Status, r.Err)
+		}
+		if r.Status != domain.BuildStatusBuilt && r.Err == nil {
+			t.Errorf("%s: expected an error explaining the %s status", r.Name, r.Status)
+		}
+	}
+}
+
+// writeModule writes a PKGBUILD producing lib/lib<name>.a with the given build() body
+// writeModule writes a module producing lib/lib<name>.a with build, lines go at the end
+func writeModule(t *testing.T, rootDir, name, build string, lines ...string) {
+	t.Helper()
+	pkgbuild := `pkgname=` + name + `
+pkgdesc="Test module"
+source=(PKGBUILD)
+
+produces() {
+    echo "lib/lib` + name + `.a"
+}
+
+build() {
+    ` + build + `
+}
+`
+	for _, line := range lines {
+		pkgbuild += line + "\n"
+	}
+	writePKGBUILD(t, rootDir, name, pkgbuild)
+}
+
+// writePKGBUILD writes rootDir/name/PKGBUILD, every fixture goes through it
+func writePKGBUILD(t *testing.T, rootDir, name, pkgbuild string) {
+	t.Helper()
+	dir := filepath.Join(rootDir, name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "PKGBUILD"), []byte(pkgbuild), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newBashOrchestrator loads rootDir with the real adapters and plans the build
+func newBashOrchestrator(t *testing.T, rootDir string, setup func(o *orchestrator.Orchestrator)) *orchestrator.Orchestrator {
+	t.Helper()
+	// one pool for both, like the cli
+	pool := bashpool.New(2)
+	loader := moduleloader.NewBashLoader()
+	loader.SetPool(pool)
+	runner := hookrunner.NewBashHookRunner()
+	runner.SetPool(pool)
+
+	o := orchestrator.NewOrchestrator(
+		loader,
+		envcontext.NewEnvProvider(),
+		runner,
+		domain.NewHost(),
+		toolchecker.NewWhichChecker(),
+	)
+	t.Cleanup(func() { o.Close() })
+	if err := o.Load(rootDir); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	o.SetOutput(t.TempDir())
+	if setup != nil {
+		setup(o)
+	}
+	if err := o.Plan(context.Background(), domain.NewTarget()); err != nil {
+		t.Fatalf("Plan: %v", err)
+	}
+	return o
+}
+
+func TestBuildTimeout(t *testing.T) {
+	rootDir := t.TempDir()
+	writeModule(t, rootDir, "slow", "sleep 30")
+
+	o := newBashOrchestrator(t, rootDir, func(o *orchestrator.Orchestrator) {
+		o.SetTimeout(200 * time.Millisecond)
+	})
+
+	start := time.Now()
+	err := o.BuildAll(context.Background(), domain.NewTarget())
+	if !errors.Is(err, orchestrator.ErrHookTimedOut) {
+		t.Fatalf("expected ErrHookTimedOut, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("hook was not killed in time, took %s", elapsed)
+	}
+}
+
+func TestBuildVerifiesProduces(t *testing.T) {
+	tests := []struct {
+		name    string
+		build   string
+		wantErr string
+	}{
+		{
+			name:  "produced",
+			build: `mkdir -p "$FOE_LIBDIR" && echo archive > "$FOE_LIBDIR/libmod.a"`,
+		},
+		{
+			name:    "missing",
+			build:   `echo "nothing to see"`,
+			wantErr: "lib/libmod.a is missing",
+		},
+		{
+			name:    "empty",
+			build:   `mkdir -p "$FOE_LIBDIR" && touch "$FOE_LIBDIR/libmod.a"`,
+			wantErr: "lib/libmod.a is empty",
+		},
+		{
+			name:    "stale",
+			build:   `mkdir -p "$FOE_LIBDIR" && echo archive > "$FOE_LIBDIR/libmod.a" && touch -d "2000-01-01" "$FOE_LIBDIR/libmod.a"`,
+			wantErr: "lib/libmod.a was not written by this build",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rootDir := t.TempDir()
+			writeModule(t, rootDir, "mod", tt.build)
+			o := newBashOrchestrator(t, rootDir, nil)
+
+			err := o.BuildAll(context.Background(), domain.NewTarget())
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("BuildAll: %v", err)
+				}
+				return
+			}
+
+			if !errors.Is(err, orchestrator.ErrArtifactNotProduced) {
+				t.Fatalf("expected ErrArtifactNotProduced, got %v", err)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %q", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestBuildWarnsUndeclared(t *testing.T) {
+	rootDir := t.TempDir()
+	writeModule(t, rootDir, "mod", `mkdir -p "$FOE_LIBDIR" && echo archive > "$FOE_LIBDIR/libmod.a" && echo stray > "$FOE_LIBDIR/libstray.a"`)
+
+	o := newBashOrchestrator(t, rootDir, func(o *orchestrator.Orchestrator) {
+		o.SetWarnUndeclared(true)
+	})
+
+	var err error
+	stderr := captureStderr(t, func() {
+		err = o.BuildAll(context.Background(), domain.NewTarget())
+	})
+	if err != nil {
+		t.Fatalf("BuildAll: %v", err)
+	}
+	if want := "warning: mod wrote lib/libstray.a, which no module declares in produces()"; !strings.Contains(stderr, want) {
+		t.Errorf("expected stderr containing %q, got %q", want, stderr)
+	}
+	if strings.Contains(stderr, "lib/libmod.a,") {
+		t.Errorf("declared produce reported as undeclared: %q", stderr)
+	}
+}
+
+// captureStderr returns what f wrote to os.Stderr, warnings included
+func captureStderr(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	defer func() { os.Stderr = stderr }()
+
+	out := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		out <- string(b)
+	}()
+	f()
+	w.Close()
+	return <-out
+}
+
+func TestStrictSources(t *testing.T) {
+	lib := `mkdir -p "$FOE_LIBDIR" && echo archive > "$FOE_LIBDIR/libmod.a"`
+	tests := []struct {
+		name    string
+		build   string
+		wantErr string
+	}{
+		{
+			name:  "out dir inside the source tree",
+			build: lib,
+		},
+		{
+			name:    "object next to the sources",
+			build:   `echo obj > "$FOE_SRCDIR/main.o" && ` + lib,
+			wantErr: "building mod: build() wrote into the source tree: created ROOT/mod/main.o",
+		},
+		{
+			name:    "other module dir",
+			build:   `echo '# touched' >> "$FOE_SRCDIR/../other/PKGBUILD" && ` + lib,
+			wantErr: "modified ROOT/other/PKGBUILD",
+		},
+		{
+			name:    "deleted file",
+			build:   `rm "$FOE_SRCDIR/notes.txt" && ` + lib,
+			wantErr: "deleted ROOT/mod/notes.txt",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rootDir := t.TempDir()
+			writeModule(t, rootDir, "mod", tt.build)
+			writeModule(t, rootDir, "other", `mkdir -p "$FOE_LIBDIR" && echo archive > "$FOE_LIBDIR/libother.a"`)
+			if err := os.WriteFile(filepath.Join(rootDir, "mod", "notes.txt"), []byte("todo\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			o := newBashOrchestrator(t, rootDir, func(o *orchestrator.Orchestrator) {
+				o.SetOutput(filepath.Join(rootDir, "out"))
+				o.SetStrictSources(true)
+			})
+
+			err := o.BuildWithDeps(context.Background(), []string{"mod"}, domain.NewTarget())
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("BuildWithDeps: %v", err)
+				}
+				return
+			}
+
+			if !errors.Is(err, orchestrator.ErrSourceWritten) {
+				t.Fatalf("expected ErrSourceWritten, got %v", err)
+			}
+			if want := strings.ReplaceAll(tt.wantErr, "ROOT", rootDir); !strings.Contains(err.Error(), want) {
+				t.Errorf("expected error containing %q, got %q", want, err)
+			}
+		})
+	}
+}
+
+// a module failing the check is not built upon, like any other failure
+func TestStrictSourcesSkipsDependents(t *testing.T) {
+	rootDir := t.TempDir()
+	lib := `mkdir -p "$FOE_LIBDIR" && echo archive > "$FOE_LIBDIR/lib$pkgname.a"`
+	writeModule(t, rootDir, "quick", lib)
+	writeModule(t, rootDir, "dirty", `echo obj > "$FOE_SRCDIR/main.o" && `+lib)
+	writeModule(t, rootDir, "app", lib, "depends=(dirty)")
+	o := newBashOrchestrator(t, rootDir, func(o *orchestrator.Orchestrator) {
+		o.SetOutput(filepath.Join(rootDir, "out"))
+		o.SetKeepGoing(true)
+		o.SetStrictSources(true)
+	})
+
+	if err := o.BuildAll(context.Background(), domain.NewTarget()); !errors.Is(err, orchestrator.ErrBuildFailed) {
+		t.Fatalf("expected ErrBuildFailed, got %v", err)
+	}
+
+	want := map[string]domain.BuildStatus{
+		"quick": domain.BuildStatusBuilt,
+		"dirty": domain.BuildStatusFailed,
+		"app":   domain.BuildStatusSkipped,
+	}
+	results := o.Report().Results
+	if len(results) != len(want) {
+		t.Fatalf("expected %d results, got %v", len(want), results)
+	}
+	for _, r := range results {
+		if r.Status != want[r.Name] {
+			t.Errorf("%s: expected %s, got %s", r.Name, want[r.Name], r.Status)
+		}
+	}
+}
+
+func TestStagingSysroot(t *testing.T) {
+	rootDir := t.TempDir()
+	outDir := t.TempDir()
+	writeModule(t, rootDir, "liba", `mkdir -p "$FOE_LIBDIR" && echo a > "$FOE_LIBDIR/libliba.a"`, `exports() { echo "INCDIR=$FOE_SRCDIR"; }`)
+	if err := os.WriteFile(filepath.Join(rootDir, "liba", "a.h"), []byte("int a(void);\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeModule(t, rootDir, "app", `test -L "$FOE_SYSROOT/include/a.h" && test -L "$FOE_SYSROOT/lib/libliba.a" && mkdir -p "$FOE_LIBDIR" && echo app > "$FOE_LIBDIR/libapp.a"`, "depends=(liba)")
+
+	stamp := filepath.Join(outDir, "sysroot", "app", ".foe-stamp")
+	build := func() os.FileInfo {
+		t.Helper()
+		o := newBashOrchestrator(t, rootDir, func(o *orchestrator.Orchestrator) {
+			o.SetOutput(outDir)
+			o.SetStagingSysroot(true)
+		})
+		if err := o.BuildAll(context.Background(), domain.NewTarget()); err != nil {
+			t.Fatalf("BuildAll: %v", err)
+		}
+		info, err := os.Stat(stamp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info
+	}
+
+	first := build()
+	if again := build(); !os.SameFile(first, again) {
+		t.Error("sysroot was staged again while the depends didn't change")
+	}
+
+	if err := os.WriteFile(filepath.Join(rootDir, "liba", "b.h"), []byte("int b(void);\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if changed := build(); os.SameFile(first, changed) {
+		t.Error("sysroot was not staged again after a new header")
+	}
+	if _, err := os.Lstat(filepath.Join(outDir, "sysroot", "app", "include", "b.h")); err != nil {
+		t.Errorf("new header not staged: %v", err)
+	}
+}
+
+func TestBuildAllCanceled(t *testing.T) {
+	runner := &fakeRunner{}
+	o := newFakeOrchestrator(t, runner,
+		&domain.Module{Name: "liba"},
+		&domain.Module{Name: "app", Depends: []string{"liba"}},
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := o.BuildAll(ctx, domain.NewTarget())
+	if !errors.Is(err, orchestrator.ErrBuildCanceled) {
+		t.Fatalf("expected ErrBuildCanceled, got %v", err)
+	}
+	if len(runner.finished) != 0 {
+		t.Errorf("expected nothing to be built, got %v", runner.finished)
+	}
+	if n := o.Report().Count(domain.BuildStatusSkipped); n != 2 {
+		t.Errorf("expected 2 skipped modules, got %d", n)
+	}
+}
+
+func TestPlanResolvesGraphPerTarget(t *testing.T) {
+	runner := &fakeRunner{}
+	o := newFakeOrchestrator(t, runner,
+		&domain.Module{Name: "platform-unix"},
+		&domain.Module{Name: "platform-win"},
+		&domain.Module{
+			Name: "app",
+			TargetDepends: map[string][]string{
+				"linux":   {"platform-unix"},
+				"windows": {"platform-win"},
+			},
+		},
+	)
+
+	for _, tt := range []struct {
+		target domain.Target
+		want   []string
+	}{
+		{domain.Target{OS: "linux", Arch: "amd64"}, []string{"platform-unix", "app"}},
+		{domain.Target{OS: "windows", Arch: "amd64"}, []string{"platform-win", "app"}},
+	} {
+		t.Run(tt.target.String(), func(t *testing.T) {
+			runner.finished = nil
+			if err := o.Plan(context.Background(), tt.target); err != nil {
+				t.Fatalf("Plan: %v", err)
+			}
+			if err := o.BuildWithDeps(context.Background(), []string{"app"}, tt.target); err != nil {
+				t.Fatalf("BuildWithDeps: %v", err)
+			}
+			if !slices.Equal(runner.finished, tt.want) {
+				t.Errorf("expected %v to be built, got %v", tt.want, runner.finished)
+			}
+		})
+	}
+}
+
+func TestBuildMatrix(t *testing.T) {
+	rootDir := t.TempDir()
+	writeModule(t, rootDir, "mod", `mkdir -p "$FOE_LIBDIR" && echo "$FOE_TARGET_ARCH" > "$FOE_LIBDIR/libmod.a"`, "depends_windows=(missing)")
+
+	// windows can't be planned: its depends doesn't exist
+
+	o := newBashOrchestrator(t, rootDir, nil)
+	outDir := t.TempDir()
+	o.SetOutput(outDir)
+
+	targets := []domain.Target{
+		{OS: "linux", Arch: "amd64"},
+		{OS: "windows", Arch: "amd64"},
+		{OS: "linux", Arch: "arm64"},
+	}
+	reports, err := o.BuildMatrix(context.Background(), targets)
+	if !errors.Is(err, orchestrator.ErrBuildFailed) || !strings.Contains(err.Error(), "amd64-windows") {
+		t.Fatalf("expected amd64-windows to fail, got %v", err)
+	}
+	if len(reports) != len(targets) {
+		t.Fatalf("expected %d reports, got %d", len(targets), len(reports))
+	}
+
+	for _, r := range reports {
+		if r.Target.OS == "windows" {
+			if r.Err == nil || r.Report != nil {
+				t.Errorf("%s: expected a plan error, got %v", r.Target, r.Err)
+			}
+			continue
+		}
+
+		if r.Err != nil || r.Report.Count(domain.BuildStatusBuilt) != 1 {
+			t.Errorf("%s: expected mod to be built, got %v", r.Target, r.Err)
+		}
+
+		// each target has its own tree
+		data, err := os.ReadFile(filepath.Join(outDir, r.Target.String(), "lib", "libmod.a"))
+		if err != nil {
+			t.Fatalf("%s: %v", r.Target, err)
+		}
+		if got := strings.TrimSpace(string(data)); got != r.Target.Arch {
+			t.Errorf("%s: expected libmod.a built for %s, got %s", r.Target, r.Target.Arch, got)
+		}
+	}
+}
+
+func TestBuildMatrixNoArch(t *testing.T) {
+	rootDir := t.TempDir()
+	log := filepath.Join(rootDir, "builds.log")
+
+	writeModule(t, rootDir, "headers", `echo "$FOE_TARGET_ARCH" >> `+log+` && mkdir -p "$FOE_LIBDIR" && echo header > "$FOE_LIBDIR/libheaders.a"`, "arch=(any)")
+	writeModule(t, rootDir, "app", `mkdir -p "$FOE_LIBDIR" && cat "$FOE_LIBDIR/libheaders.a" > "$FOE_LIBDIR/libapp.a"`, "depends=(headers)")
+
+	for _, withState := range []bool{false, true} {
+		os.Remove(log)
+		o := newBashOrchestrator(t, rootDir, func(o *orchestrator.Orchestrator) {
+			if withState {
+				o.SetStateStore(buildstate.NewJSONStore())
+			}
+		})
+		outDir := t.TempDir()
+		o.SetOutput(outDir)
+
+		targets := []domain.Target{{OS: "linux", Arch: "amd64"}, {OS: "linux", Arch: "arm64"}}
+		if _, err := o.BuildMatrix(context.Background(), targets); err != nil {
+			t.Fatalf("BuildMatrix: %v", err)
+		}
+
+		data, err := os.ReadFile(log)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Fields(string(data)); !slices.Equal(got, []string{"any"}) {
+			t.Errorf("state %v: expected headers to be built once for any, got %v", withState, got)
+		}
+
+		for _, target := range targets {
+			data, err := os.ReadFile(filepath.Join(outDir, target.String(), "lib", "libapp.a"))
+			if err != nil || strings.TrimSpace(string(data)) != "header" {
+				t.Errorf("state %v: %s didn't see the shared headers: %v", withState, target, err)
+			}
+		}
+	}
+}
+
+func TestNoArchDependsOnTarget(t *testing.T) {
+	o := orchestrator.NewOrchestrator(
+		&fakeLoader{modules: []*domain.Module{
+			{Name: "libc"},
+			{Name: "headers", Arch: []string{"any"}, Depends: []string{"libc"}},
+		}},
+		envcontext.NewEnvProvider(),
+		&fakeRunner{},
+		domain.NewHost(),
+		fakeChecker{},
+	)
+
+	err := o.Load(".")
+	if err == nil || !strings.Contains(err.Error(), "headers is arch=(any) but depends on libc") {
+		t.Fatalf("expected a noarch error, got %v", err)
+	}
+}
+
+func TestPlanExcludesUnsupported(t *testing.T) {
+	o := newFakeOrchestrator(t, &fakeRunner{},
+		&domain.Module{Name: "platform-unix", OS: []string{"linux", "darwin"}, Provides: []string{"platform"}},
+		&domain.Module{Name: "platform-win", OS: []string{"windows"}, Provides: []string{"platform"}},
+		&domain.Module{Name: "app", Depends: []string{"platform"}},
+	)
+
+	windows := domain.Target{OS: "windows", Arch: "amd64"}
+	if err := o.Plan(context.Background(), windows); err != nil {
+		t.Fatalf("Plan: %v", err)
+	}
+
+	if got := o.Order(); !slices.Equal(got, []string{"platform-win", "app"}) {
+		t.Errorf("expected platform-win and app, got %v", got)
+	}
+	excluded := o.Excluded()
+	if len(excluded) != 1 || excluded[0].Name != "platform-unix" {
+		t.Errorf("expected platform-unix to be excluded, got %v", excluded)
+	}
+
+	// nothing supports plan9, app can't be built
+	err := o.Plan(context.Background(), domain.Target{OS: "plan9", Arch: "amd64"})
+	if !errors.Is(err, domain.ErrUnsupportedDependency) {
+		t.Errorf("expected ErrUnsupportedDependency, got %v", err)
+	}
+}
+
+func TestBuildHostTools(t *testing.T) {
+	rootDir := t.TempDir()
+	writePKGBUILD(t, rootDir, "gen", `pkgname=gen
+pkgdesc="Code generator"
+source=(PKGBUILD)
+produces() { echo "bin/gen"; }
+build() {
+    mkdir -p "$FOE_BINDIR"
+    printf '#!/bin/sh\necho "generated on %s"\n' "$FOE_TARGET_ARCH-$FOE_TARGET_OS" > "$FOE_BINDIR/gen"
+    chmod +x "$FOE_BINDIR/gen"
+}
+`)
+	writePKGBUILD(t, rootDir, "proto", `pkgname=proto
+pkgdesc="Generated library"
+source=(PKGBUILD)
+hostdepends=(gen)
+produces() { echo "lib/libproto.a"; }
+build() {
+    mkdir -p "$FOE_LIBDIR"
+    gen > "$FOE_LIBDIR/libproto.a"
+}
+`)
+	// a noarch module runs gen too, whatever the target
+	writePKGBUILD(t, rootDir, "docs", `pkgname=docs
+pkgdesc="Generated docs"
+source=(PKGBUILD)
+arch=(any)
+hostdepends=(gen)
+produces() { echo "share/docs.txt"; }
+build() {
+    mkdir -p "$FOE_OUTDIR/share"
+    gen > "$FOE_OUTDIR/share/docs.txt"
+}
+`)
+
+	host := domain.NewHost()
+	tests := []struct {
+		name     string
+		target   domain.Target
+		wantTool string // where gen is built
+		wantHost string // host: results in the report
+	}{
+		{
+			name:     "native",
+			target:   host.Target(),
+			wantTool: "bin/gen",
+		},
+		{
+			name:     "cross",
+			target:   domain.Target{OS: host.OS, Arch: "riscv64"},
+			wantTool: "host/bin/gen",
+			wantHost: "host:gen",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newBashOrchestrator(t, rootDir, nil)
+			outDir := t.TempDir()
+			o.SetOutput(outDir)
+
+			if err := o.Plan(context.Background(), tt.target); err != nil {
+				t.Fatalf("Plan: %v", err)
+			}
+			if err := o.BuildWithDeps(context.Background(), []string{"proto", "docs"}, tt.target); err != nil {
+				t.Fatalf("BuildWithDeps: %v", err)
+			}
+
+			if _, err := os.Stat(filepath.Join(outDir, tt.wantTool)); err != nil {
+				t.Errorf("expected gen in %s: %v", tt.wantTool, err)
+			}
+
+			// gen always runs on the host
+			for _, produce := range []string{"lib/libproto.a", "share/docs.txt"} {
+				data, err := os.ReadFile(filepath.Join(outDir, produce))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want := "generated on " + host.String(); strings.TrimSpace(string(data)) != want {
+					t.Errorf("%s: expected %q, got %q", produce, want, data)
+				}
+			}
+
+			if tt.wantHost != "" && o.Report().Results[0].Name != tt.wantHost {
+				t.Errorf("expected %s first in the report, got %v", tt.wantHost, o.Report().Results)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/73NN0/foe-hammer/internal/orchestrator/domain"
+)
+
+type buildResult struct {
+	name   string
+	status domain.BuildStatus
+	err    error
+}
+
+// schedule builds the given modules, keeping up to o.jobs hooks running at once.
+// A module starts as soon as all of its depends that are part of names have finished.
+// Depends outside of names are considered already built.
+//
+// On failure no new module is started, running ones are waited for
+// and the first error is returned.
+// With keepGoing, only the dependents of the failed module are skipped
+// and the returned error lists every failed module.
+// When ctx is done running hooks are killed, nothing new is started
+// and ErrBuildCanceled is returned.
+// Either way, o.Report() tells what happened to each module.
+func (o *Orchestrator) schedule(ctx context.Context, names []string, target domain.Target) error {
+	// host tools first, see host.go
+	hostResults, err := o.buildHostTools(ctx, names)
+	if err != nil {
+		report := &domain.BuildReport{Results: hostResults}
+		for _, name := range names {
+			report.Add(domain.ModuleResult{Name: name, Status: domain.BuildStatusSkipped, Err: err})
+		}
+		o.report = report
+		return err
+	}
+
+	inSet := make(map[string]bool, len(names))
+	for _, name := range names {
+		inSet[name] = true
+	}
+
+	// same bookkeeping as Kahn in TopoSort, restricted to names
+	indegree := make(map[string]int, len(names))
+	requiredBy := make(map[string][]string, len(names))
+	for _, name := range names {
+		m, err := o.graph.Get(name)
+		if err != nil {
+			return err
+		}
+		for _, dep := range m.Depends {
+			if !inSet[dep] {
+				continue
+			}
+			indegree[name]++
+			requiredBy[dep] = append(requiredBy[dep], name)
+		}
+	}
+
+	// names is expected in topo order, keep it for the ready queue
+	ready := make([]string, 0, len(names))
+	for _, name := range names {
+		if indegree[name] == 0 {
+			ready = append(ready, name)
+		}
+	}
+
+	results := make(chan buildResult)
+	done := make(map[string]buildResult, len(names))
+	running := 0
+	var firstErr error
+	stop := false
+
+	for {
+		if ctx.Err() != nil {
+			stop = true
+		}
+
+		for !stop && running < o.jobs && len(ready) > 0 {
+			name := ready[0]
+			ready = ready[1:]
+			running++
+
+			fmt.Printf("Building %s...\n", name)
+			go func() {
+				status, err := o.build(ctx, name, target)
+				results <- buildResult{name: name, status: status, err: err}
+			}()
+		}
+
+		if running == 0 {
+			break
+		}
+
+		r := <-results
+		running--
+
+		if r.err != nil {
+			r.status = domain.BuildStatusFailed
+			done[r.name] = r
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			if !o.keepGoing {
+				stop = true
+			}
+			skipDependents(r.name, requiredBy, done)
+			continue
+		}
+
+		done[r.name] = r
+		for _, dependent := range requiredBy[r.name] {
+			indegree[dependent]--
+			if indegree[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+
+	notStarted := fmt.Errorf("build stopped after a failure")
+	if ctx.Err() != nil {
+		notStarted = fmt.Errorf("%w: %w", ErrBuildCanceled, context.Cause(ctx))
+	}
+
+	report := &domain.BuildReport{Results: hostResults}
+	for _, name := range names {
+		r, ok := done[name]
+		if !ok {
+			r = buildResult{name: name, status: domain.BuildStatusSkipped, err: notStarted}
+		}
+		report.Add(domain.ModuleResult{Name: r.name, Status: r.status, Err: r.err})
+	}
+	o.report = report
+
+	if ctx.Err() != nil {
+		return notStarted
+	}
+
+	if firstErr == nil || !o.keepGoing {
+		return firstErr
+	}
+
+	return fmt.Errorf("%w: %s", ErrBuildFailed, strings.Join(report.Failed(), ", "))
+}
+
+// skipDependents marks every transitive dependent of failed as skipped
+func skipDependents(failed string, requiredBy map[string][]string, done map[string]buildResult) {
+	queue := append([]string(nil), requiredBy[failed]...)
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+
+		if _, ok := done[name]; ok {
+			continue
+		}
+		done[name] = buildResult{
+			name:   name,
+			status: domain.BuildStatusSkipped,
+			err:    fmt.Errorf("dependency %s failed", failed),
+		}
+		queue = append(queue, requiredBy[name]...)
+	}
+}
@@ -0,0 +1,127 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/73NN0/foe-hammer/internal/orchestrator/domain"
+)
+
+var ErrSourceWritten = errors.New("build() wrote into the source tree")
+
+// vcsDirs are never written by hooks, don't walk them
+var vcsDirs = []string{".git", ".hg", ".svn"}
+
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// sourceSnapshot maps every file of the modules dirs to its size and mtime
+type sourceSnapshot map[string]fileStamp
+
+// snapshotSources records the files of every loaded module dir, FOE_SRCDIR and the others,
+// without the out dir when it is inside the source tree.
+func (o *Orchestrator) snapshotSources() sourceSnapshot {
+	snap := make(sourceSnapshot)
+	for _, dir := range o.sourceDirs() {
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() {
+				if path != dir && (slices.Contains(vcsDirs, d.Name()) || o.isOutput(path)) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			snap[path] = fileStamp{size: info.Size(), modTime: info.ModTime()}
+			return nil
+		})
+	}
+	return snap
+}
+
+// sourceDirs returns the dirs of the loaded modules, without the ones inside another one
+func (o *Orchestrator) sourceDirs() []string {
+	var dirs []string
+	for _, m := range o.modules {
+		if abs, err := filepath.Abs(m.DirPath); err == nil {
+			dirs = append(dirs, abs)
+		}
+	}
+	slices.Sort(dirs)
+	dirs = slices.Compact(dirs)
+
+	var top []string
+	for _, dir := range dirs {
+		if len(top) > 0 && isInside(dir, top[len(top)-1]) {
+			continue
+		}
+		top = append(top, dir)
+	}
+	return top
+}
+
+// isOutput tells if dir is where foe writes, see SetOutput
+func (o *Orchestrator) isOutput(dir string) bool {
+	for _, out := range []string{o.outDir, o.hostDir, o.noarchDir, filepath.Dir(o.noarchDir)} {
+		if out != "" && out != "." && dir == out {
+			return true
+		}
+	}
+	return false
+}
+
+// changes lists the files created, modified or deleted since snap was taken
+func (snap sourceSnapshot) changes(after sourceSnapshot) []string {
+	var changed []string
+	for path, stamp := range after {
+		before, ok := snap[path]
+		switch {
+		case !ok:
+			changed = append(changed, "created "+path)
+		case before.size != stamp.size || !before.modTime.Equal(stamp.modTime):
+			changed = append(changed, "modified "+path)
+		}
+	}
+	for path := range snap {
+		if _, ok := after[path]; !ok {
+			changed = append(changed, "deleted "+path)
+		}
+	}
+	slices.Sort(changed)
+	return changed
+}
+
+// checkSources reports the files build() of m wrote into the source tree since before,
+// an error in strict mode. With parallel builds a file may come from a module built alongside.
+func (o *Orchestrator) checkSources(m *domain.Module, before sourceSnapshot) error {
+	changed := before.changes(o.snapshotSources())
+	if len(changed) == 0 {
+		return nil
+	}
+
+	if o.strictSources {
+		return fmt.Errorf("%w: %s", ErrSourceWritten, strings.Join(changed, ", "))
+	}
+	for _, c := range changed {
+		fmt.Fprintf(os.Stderr, "warning: %s %s in the source tree\n", m.Name, c)
+	}
+	return nil
+}
+
+func isInside(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, "../")
+}
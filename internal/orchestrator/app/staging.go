@@ -0,0 +1,133 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/73NN0/foe-hammer/internal/orchestrator/domain"
+)
+
+// staging sysroots gather what the transitive depends of a module export,
+// so its hooks need a single --sysroot="$FOE_SYSROOT":
+//
+//	bin/sysroot/app/include/b.h -> libb/b.h           (headers of exports() INCDIR)
+//	bin/sysroot/app/include/a.h -> liba/a.h
+//	bin/sysroot/app/lib/libb.a  -> bin/lib/libb.a     (produces)
+//
+// A sysroot of the toolchain stays available as FOE_TOOLCHAIN_SYSROOT.
+
+const stagingStamp = ".foe-stamp"
+
+var headerExts = []string{".h", ".hh", ".hpp", ".hxx", ".inl"}
+var libraryExts = []string{".a", ".so", ".dylib", ".lib", ".dll"}
+
+// SetStagingSysroot gives every module a sysroot assembled from its depends, see staging.go
+func (o *Orchestrator) SetStagingSysroot(staging bool) {
+	o.staging = staging
+}
+
+// stagingDir returns the staging sysroot of m, per target as it lives in its out dir
+func (o *Orchestrator) stagingDir(m *domain.Module) string {
+	return filepath.Join(o.dirFor(m), "sysroot", m.Name)
+}
+
+// stageSysroot links the headers and libraries of the depends of m into its staging sysroot.
+// It is rebuilt only when the staged files changed since the last time.
+func (o *Orchestrator) stageSysroot(m *domain.Module) error {
+	dir := o.stagingDir(m)
+	entries := o.stagingEntries(m)
+
+	stamp := stagingHash(entries)
+	if old, err := os.ReadFile(filepath.Join(dir, stagingStamp)); err == nil && string(old) == stamp {
+		return nil
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("staging sysroot of %s: %w", m.Name, err)
+	}
+	for _, sub := range []string{"include", "lib"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return fmt.Errorf("staging sysroot of %s: %w", m.Name, err)
+		}
+	}
+	for _, dst := range slices.Sorted(maps.Keys(entries)) {
+		path := filepath.Join(dir, dst)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("staging sysroot of %s: %w", m.Name, err)
+		}
+		if err := os.Symlink(entries[dst], path); err != nil {
+			return fmt.Errorf("staging sysroot of %s: %w", m.Name, err)
+		}
+	}
+
+	// last, an interrupted staging is redone
+	if err := os.WriteFile(filepath.Join(dir, stagingStamp), []byte(stamp), 0644); err != nil {
+		return fmt.Errorf("staging sysroot of %s: %w", m.Name, err)
+	}
+	return nil
+}
+
+// stagingEntries maps the paths in the sysroot of m to the files of its depends:
+// headers of their exported INCDIR into include/, their produces under include/ and lib/,
+// other produces by extension. The closest depend wins when two stage the same path.
+func (o *Orchestrator) stagingEntries(m *domain.Module) map[string]string {
+	entries := make(map[string]string)
+	add := func(dst, src string) {
+		if old, ok := entries[dst]; ok && old != src {
+			fmt.Fprintf(os.Stderr, "warning: sysroot of %s: %s is staged from %s, not %s\n", m.Name, dst, old, src)
+			return
+		}
+		entries[dst] = src
+	}
+
+	deps := o.depsOf(m)
+	for i := len(deps) - 1; i >= 0; i-- {
+		dep := deps[i]
+
+		if incdir := dep.Exports["INCDIR"]; incdir != "" {
+			filepath.WalkDir(incdir, func(path string, d fs.DirEntry, err error) error {
+				if err != nil || d.IsDir() || !slices.Contains(headerExts, filepath.Ext(path)) {
+					return nil
+				}
+				if rel, err := filepath.Rel(incdir, path); err == nil {
+					add(filepath.Join("include", rel), path)
+				}
+				return nil
+			})
+		}
+
+		for _, produce := range dep.Produces {
+			produce = filepath.Clean(produce)
+			src := filepath.Join(o.dirFor(m), produce)
+			switch ext := filepath.Ext(produce); {
+			case strings.HasPrefix(produce, "include/"), strings.HasPrefix(produce, "lib/"):
+				add(produce, src)
+			case slices.Contains(headerExts, ext):
+				add(filepath.Join("include", filepath.Base(produce)), src)
+			case slices.Contains(libraryExts, ext):
+				add(filepath.Join("lib", filepath.Base(produce)), src)
+			}
+		}
+	}
+	return entries
+}
+
+// stagingHash identifies the staged files by path, size and mtime
+func stagingHash(entries map[string]string) string {
+	h := sha256.New()
+	for _, dst := range slices.Sorted(maps.Keys(entries)) {
+		src := entries[dst]
+		fmt.Fprintf(h, "%s\x00%s\x00", dst, src)
+		if info, err := os.Stat(src); err == nil {
+			fmt.Fprintf(h, "%d\x00%d\x00", info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,82 @@
+package app
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/73NN0/foe-hammer/internal/orchestrator/domain"
+)
+
+// verifyProduces checks that build() really created what produces() promised:
+// every artifact exists under its out dir, is not empty and was written after start.
+func (o *Orchestrator) verifyProduces(m *domain.Module, start time.Time) error {
+	// some filesystems only keep seconds
+	since := start.Truncate(time.Second)
+
+	var problems []string
+	for _, produce := range m.Produces {
+		info, err := os.Stat(filepath.Join(o.dirFor(m), produce))
+		switch {
+		case err != nil:
+			problems = append(problems, produce+" is missing")
+		case info.IsDir():
+			problems = append(problems, produce+" is a directory")
+		case info.Size() == 0:
+			problems = append(problems, produce+" is empty")
+		case info.ModTime().Before(since):
+			problems = append(problems, produce+" was not written by this build")
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrArtifactNotProduced, strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// reportUndeclared warns about files written since start, next to the produces of m,
+// that no module declares. With parallel builds a file may come from another module.
+func (o *Orchestrator) reportUndeclared(m *domain.Module, start time.Time) {
+	declared := make(map[string]bool)
+	for _, other := range o.graph.All() {
+		for _, produce := range other.Produces {
+			declared[filepath.Clean(produce)] = true
+		}
+	}
+
+	// only look where the module writes its outputs
+	dirs := make(map[string]bool)
+	for _, produce := range m.Produces {
+		dirs[filepath.Dir(filepath.Clean(produce))] = true
+	}
+
+	for dir := range dirs {
+		if dir == "." {
+			// directly in the out dir, scanning it would walk every other module outputs
+			continue
+		}
+
+		outDir := o.dirFor(m)
+		filepath.WalkDir(filepath.Join(outDir, dir), func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			info, err := d.Info()
+			// no truncation here, better miss a file than blame the wrong module
+			if err != nil || info.ModTime().Before(start) {
+				return nil
+			}
+
+			rel, err := filepath.Rel(outDir, path)
+			if err != nil || declared[rel] {
+				return nil
+			}
+			fmt.Fprintf(os.Stderr, "warning: %s wrote %s, which no module declares in produces()\n", m.Name, rel)
+			return nil
+		})
+	}
+}
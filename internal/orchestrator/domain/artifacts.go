@@ -0,0 +1,59 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+var (
+	ErrArtifactConflict = errors.New("artifact conflict")
+	ErrArtifactNoOwner  = errors.New("no module produces")
+)
+
+// ArtifactIndex maps every declared artifact, relative to the out dir,
+// to the module producing it.
+type ArtifactIndex struct {
+	owners map[string]*Module
+}
+
+// NewArtifactIndex indexes the produces of modules.
+// Two modules claiming the same path is an error, every conflict is reported.
+func NewArtifactIndex(modules []*Module) (*ArtifactIndex, error) {
+	idx := &ArtifactIndex{owners: make(map[string]*Module)}
+
+	// sorted so the error is the same from one run to another
+	sorted := slices.Clone(modules)
+	slices.SortFunc(sorted, func(a, b *Module) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	var errs []error
+	for _, m := range sorted {
+		for _, produce := range m.Produces {
+			path := filepath.Clean(produce)
+			if owner, exists := idx.owners[path]; exists && owner != m {
+				errs = append(errs, fmt.Errorf("%w: %s is produced by %s (%s) and %s (%s)",
+					ErrArtifactConflict, path, owner.Name, owner.Path, m.Name, m.Path))
+				continue
+			}
+			idx.owners[path] = m
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return idx, nil
+}
+
+// Owner returns the module producing path (relative to the out dir)
+func (idx *ArtifactIndex) Owner(path string) (*Module, error) {
+	m, ok := idx.owners[filepath.Clean(path)]
+	if !ok {
+		return nil, fmt.Errorf("%w %s", ErrArtifactNoOwner, path)
+	}
+	return m, nil
+}
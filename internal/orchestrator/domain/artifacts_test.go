@@ -0,0 +1,49 @@
+package domain_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/73NN0/foe-hammer/internal/orchestrator/domain"
+)
+
+func TestArtifactIndex(t *testing.T) {
+	liba := &domain.Module{Name: "liba", Path: "/src/liba/PKGBUILD", Produces: []string{"lib/liba.a"}}
+	app := &domain.Module{Name: "app", Path: "/src/app/PKGBUILD", Produces: []string{"bin/app", "share/app.dat"}}
+
+	idx, err := domain.NewArtifactIndex([]*domain.Module{liba, app})
+	if err != nil {
+		t.Fatalf("NewArtifactIndex: %v", err)
+	}
+
+	owner, err := idx.Owner("bin/app")
+	if err != nil || owner != app {
+		t.Errorf("expected app to own bin/app, got %v %v", owner, err)
+	}
+
+	owner, err = idx.Owner("./lib//liba.a")
+	if err != nil || owner != liba {
+		t.Errorf("expected liba to own lib/liba.a, got %v %v", owner, err)
+	}
+
+	if _, err := idx.Owner("bin/other"); !errors.Is(err, domain.ErrArtifactNoOwner) {
+		t.Errorf("expected ErrArtifactNoOwner, got %v", err)
+	}
+}
+
+func TestArtifactIndexConflict(t *testing.T) {
+	unix := &domain.Module{Name: "platform-unix", Path: "/src/platform-unix/PKGBUILD", Produces: []string{"lib/libplatform.a"}}
+	stub := &domain.Module{Name: "platform-stub", Path: "/src/platform-stub/PKGBUILD", Produces: []string{"lib/libplatform.a"}}
+
+	_, err := domain.NewArtifactIndex([]*domain.Module{unix, stub})
+	if !errors.Is(err, domain.ErrArtifactConflict) {
+		t.Fatalf("expected ErrArtifactConflict, got %v", err)
+	}
+
+	for _, want := range []string{"lib/libplatform.a", unix.Path, stub.Path} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to name %s, got %q", want, err)
+		}
+	}
+}
@@ -159,3 +159,34 @@ func (g *ModuleGraph) Descendants(name string) []string {
 
 	return result
 }
+
+// liba ──→ libb ──→ exe
+//
+// libX ──→ libY ──→ exe
+// Ancestors("libb") => ["liba", "libb"]
+// Ancestors("exe")  => ["liba", "libb", "libX", "libY", "exe"] (some topo order)
+func (g *ModuleGraph) Ancestors(names ...string) []string {
+	// Set des modules requis, parcours des depends depuis names
+	required := make(map[string]bool)
+	stack := append([]string(nil), names...)
+	for len(stack) > 0 {
+		name := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if required[name] {
+			continue
+		}
+		required[name] = true
+		stack = append(stack, g.edges[name]...)
+	}
+
+	// on garde l'ordre topo
+	var result []string
+	for _, modName := range g.order {
+		if required[modName] {
+			result = append(result, modName)
+		}
+	}
+
+	return result
+}
@@ -37,3 +37,62 @@ func TestTopoSort(t *testing.T) {
 		}
 	}
 }
+
+func TestAncestors(t *testing.T) {
+	g := domain.NewModuleGraph()
+
+	// liba ──→ libb ──→ app
+	// libx ──→ liby ──→ app
+	// libz (unrelated)
+	g.Add(&domain.Module{Name: "liba"})
+	g.Add(&domain.Module{Name: "libb", Depends: []string{"liba"}})
+	g.Add(&domain.Module{Name: "libx"})
+	g.Add(&domain.Module{Name: "liby", Depends: []string{"libx"}})
+	g.Add(&domain.Module{Name: "app", Depends: []string{"libb", "liby"}})
+	g.Add(&domain.Module{Name: "libz"})
+
+	if err := g.TopoSort(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		names []string
+		want  []string
+	}{
+		{name: "leaf", names: []string{"liba"}, want: []string{"liba"}},
+		{name: "chain", names: []string{"libb"}, want: []string{"liba", "libb"}},
+		{name: "whole tree", names: []string{"app"}, want: []string{"liba", "libb", "libx", "liby", "app"}},
+		{name: "several", names: []string{"libb", "libz"}, want: []string{"liba", "libb", "libz"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := g.Ancestors(tt.names...)
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+
+			position := make(map[string]int)
+			for i, name := range got {
+				position[name] = i
+			}
+			for _, name := range tt.want {
+				if _, ok := position[name]; !ok {
+					t.Fatalf("expected %v, got %v", tt.want, got)
+				}
+			}
+
+			// topological order
+			for _, name := range got {
+				m, _ := g.Get(name)
+				for _, dep := range m.Depends {
+					if position[dep] > position[name] {
+						t.Errorf("%s should come before %s", dep, name)
+					}
+				}
+			}
+		})
+	}
+}
@@ -1,22 +1,34 @@
 package domain
 
 import (
-	"fmt"
 	"runtime"
 )
 
-// from which platform we compile
+// from which platform we compile, same fields as Target
 type Host struct {
-	OS   string
-	Arch string
+	OS     string
+	Arch   string
+	Vendor string
+	ABI    string
 }
 
 func (h Host) String() string {
-	return fmt.Sprintf("%v-%v", h.Arch, h.OS)
+	return h.Target().String()
 }
 
+// CrossCompilingTo reports whether binaries built for t can't run on the host
 func (h Host) CrossCompilingTo(t Target) bool {
-	return h.OS != t.OS || h.Arch != t.Arch
+	return h.OS != t.OS || h.Arch != t.Arch || h.ABI != t.ABI
+}
+
+// Target returns the target of a native build
+func (h Host) Target() Target {
+	return Target{OS: h.OS, Arch: h.Arch, Vendor: h.Vendor, ABI: h.ABI}
+}
+
+// Triple returns the GNU triple of the host, see Target.Triple
+func (h Host) Triple() string {
+	return h.Target().Triple()
 }
 
 func NewHost() Host {
@@ -1,5 +1,10 @@
 package domain
 
+import (
+	"slices"
+	"time"
+)
+
 // represent a parsed PKGBUILD
 
 type Module struct {
@@ -7,8 +12,57 @@ type Module struct {
 	DirPath     string // Directory where the module lives
 	Path        string // full path (abs)
 	Description string
-	Produces    []string // relatifs paths of build artefacts
-	Depends     []string // dependency modules
-	MakeDepends []string // external dependency (SDL2 etc...)
-	Sources     []string // sources files
+	Produces    []string      // relatifs paths of build artefacts
+	Depends     []string      // dependency modules
+	MakeDepends []string      // external dependency (SDL2 etc...)
+	HostDepends []string      // modules built for the host and run by the hooks (code generators...)
+	Sources     []string      // sources files
+	Provides    []string      // virtual names this module can stand for (platform...)
+	Conflicts   []string      // modules or virtual names that can't be built along this one
+	Timeout     time.Duration // max duration of build(), 0 = none
+	KeepEnv     []string      // variables of the environment of foe passed to the hooks (CCACHE_DIR...)
+	Arch        []string      // supported architectures, arch=(any) for modules that don't depend on the target
+	OS          []string      // supported operating systems, empty = all
+	Hooks       []string      // optional hooks the PKGBUILD defines (exports...)
+
+	// KEY=VALUE printed by exports(), given to the dependents (FOE_DEP_<NAME>_<KEY>), resolved by Plan
+	Exports map[string]string
+
+	// target-conditional arrays by suffix: depends_linux=() => TargetDepends["linux"]
+	TargetDepends     map[string][]string
+	TargetMakeDepends map[string][]string
+	TargetSources     map[string][]string
+}
+
+// NoArch reports whether the module is the same for every target (arch=(any)),
+// like header-only libraries or generated data.
+func (m *Module) NoArch() bool {
+	return slices.Contains(m.Arch, "any")
+}
+
+// HasHook reports whether the PKGBUILD defines the optional hook
+func (m *Module) HasHook(hook string) bool {
+	return slices.Contains(m.Hooks, hook)
+}
+
+// ForTarget returns a copy of the module where the target-conditional arrays
+// matching target (see Target.Suffixes) are merged into Depends, MakeDepends and Sources.
+func (m *Module) ForTarget(target Target) *Module {
+	r := *m
+	r.Depends = mergeSuffixed(m.Depends, m.TargetDepends, target)
+	r.MakeDepends = mergeSuffixed(m.MakeDepends, m.TargetMakeDepends, target)
+	r.Sources = mergeSuffixed(m.Sources, m.TargetSources, target)
+	return &r
+}
+
+func mergeSuffixed(base []string, bySuffix map[string][]string, target Target) []string {
+	merged := slices.Clone(base)
+	for _, suffix := range target.Suffixes() {
+		for _, item := range bySuffix[suffix] {
+			if !slices.Contains(merged, item) {
+				merged = append(merged, item)
+			}
+		}
+	}
+	return merged
 }
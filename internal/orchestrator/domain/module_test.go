@@ -0,0 +1,63 @@
+package domain_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/73NN0/foe-hammer/internal/orchestrator/domain"
+)
+
+func TestModuleForTarget(t *testing.T) {
+	m := &domain.Module{
+		Name:    "portable",
+		Depends: []string{"libcore"},
+		Sources: []string{"common.c"},
+		TargetDepends: map[string][]string{
+			"linux":   {"platform-unix"},
+			"windows": {"platform-win"},
+			"x86_64":  {"libsimd"},
+		},
+		TargetSources: map[string][]string{
+			"linux_arm64": {"neon.c"},
+		},
+	}
+
+	tests := []struct {
+		target      domain.Target
+		wantDepends []string
+		wantSources []string
+	}{
+		{
+			target:      domain.Target{OS: "linux", Arch: "amd64"},
+			wantDepends: []string{"libcore", "platform-unix", "libsimd"},
+			wantSources: []string{"common.c"},
+		},
+		{
+			target:      domain.Target{OS: "linux", Arch: "arm64"},
+			wantDepends: []string{"libcore", "platform-unix"},
+			wantSources: []string{"common.c", "neon.c"},
+		},
+		{
+			target:      domain.Target{OS: "windows", Arch: "amd64"},
+			wantDepends: []string{"libcore", "platform-win", "libsimd"},
+			wantSources: []string{"common.c"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target.String(), func(t *testing.T) {
+			r := m.ForTarget(tt.target)
+			if !slices.Equal(r.Depends, tt.wantDepends) {
+				t.Errorf("depends: expected %v, got %v", tt.wantDepends, r.Depends)
+			}
+			if !slices.Equal(r.Sources, tt.wantSources) {
+				t.Errorf("sources: expected %v, got %v", tt.wantSources, r.Sources)
+			}
+		})
+	}
+
+	// the loaded module is left untouched
+	if !slices.Equal(m.Depends, []string{"libcore"}) {
+		t.Errorf("ForTarget modified the module: %v", m.Depends)
+	}
+}
@@ -0,0 +1,163 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var (
+	ErrProviderMissing   = errors.New("no provider")
+	ErrProviderAmbiguous = errors.New("ambiguous provider")
+	ErrModuleConflict    = errors.New("conflicting modules")
+)
+
+// ProviderSelection maps a virtual name (PKGBUILD provides=) to the module chosen to provide it.
+//
+//	platform-unix: provides=(platform)
+//	platform-stub: provides=(platform)
+//	app:           depends=(platform)
+//
+// ProviderSelection{"platform": "platform-stub"} builds app against platform-stub.
+type ProviderSelection map[string]string
+
+// ResolveProviders returns the modules of the build once virtual names are resolved:
+//   - a depends on a virtual name is rewritten to the chosen provider
+//   - providers that were not chosen are dropped
+//   - two remaining modules declaring a conflict is an error
+//
+// A real module name always wins over a virtual one.
+// A virtual name with several providers needs a selection, unless nobody depends on it.
+func ResolveProviders(modules []*Module, sel ProviderSelection) ([]*Module, error) {
+	byName := make(map[string]*Module, len(modules))
+	providers := make(map[string][]string) // virtual -> module names
+	for _, m := range modules {
+		byName[m.Name] = m
+		for _, virtual := range m.Provides {
+			providers[virtual] = append(providers[virtual], m.Name)
+		}
+	}
+
+	// virtual names to resolve: selected ones and depended on ones
+	wanted := make(map[string]bool)
+	for virtual := range sel {
+		wanted[virtual] = true
+	}
+	for _, m := range modules {
+		for _, dep := range m.Depends {
+			if _, real := byName[dep]; !real && len(providers[dep]) > 0 {
+				wanted[dep] = true
+			}
+		}
+	}
+
+	chosen := make(map[string]string, len(wanted))
+	dropped := make(map[string]bool)
+	var errs []error
+	for virtual := range wanted {
+		if _, real := byName[virtual]; real {
+			continue
+		}
+
+		candidates := slices.Sorted(slices.Values(providers[virtual]))
+		name, err := choose(virtual, candidates, sel)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		chosen[virtual] = name
+		for _, c := range candidates {
+			if c != name {
+				dropped[c] = true
+			}
+		}
+	}
+	if len(errs) > 0 {
+		slices.SortFunc(errs, func(a, b error) int { return strings.Compare(a.Error(), b.Error()) })
+		return nil, errors.Join(errs...)
+	}
+
+	// a chosen provider always stays, even if it is an alternative of another virtual name
+	for _, name := range chosen {
+		delete(dropped, name)
+	}
+
+	resolved := make([]*Module, 0, len(modules))
+	for _, m := range modules {
+		if dropped[m.Name] {
+			continue
+		}
+
+		// copy, modules may be resolved again with another selection
+		r := *m
+		r.Depends = make([]string, len(m.Depends))
+		for i, dep := range m.Depends {
+			if name, ok := chosen[dep]; ok {
+				dep = name
+			}
+			r.Depends[i] = dep
+		}
+		resolved = append(resolved, &r)
+	}
+
+	if err := checkConflicts(resolved); err != nil {
+		return nil, err
+	}
+
+	return resolved, nil
+}
+
+func choose(virtual string, candidates []string, sel ProviderSelection) (string, error) {
+	if name, ok := sel[virtual]; ok {
+		if !slices.Contains(candidates, name) {
+			return "", fmt.Errorf("%w for %s: %s was selected but doesn't provide it (providers: %s)",
+				ErrProviderMissing, virtual, name, listOrNone(candidates))
+		}
+		return name, nil
+	}
+
+	switch len(candidates) {
+	case 0:
+		return "", fmt.Errorf("%w for %s", ErrProviderMissing, virtual)
+	case 1:
+		return candidates[0], nil
+	default:
+		return "", fmt.Errorf("%w for %s: %s, select one (--provide %s=<module>)",
+			ErrProviderAmbiguous, virtual, strings.Join(candidates, ", "), virtual)
+	}
+}
+
+// checkConflicts reports modules of the build declaring a conflict with another one,
+// by name or by a virtual name it provides. A module never conflicts with itself.
+func checkConflicts(modules []*Module) error {
+	names := make(map[string][]string) // real or virtual name -> modules
+	for _, m := range modules {
+		names[m.Name] = append(names[m.Name], m.Name)
+		for _, virtual := range m.Provides {
+			names[virtual] = append(names[virtual], m.Name)
+		}
+	}
+
+	var errs []error
+	for _, m := range modules {
+		for _, conflict := range m.Conflicts {
+			for _, other := range names[conflict] {
+				if other == m.Name {
+					continue
+				}
+				errs = append(errs, fmt.Errorf("%w: %s conflicts with %s (%s)", ErrModuleConflict, m.Name, other, conflict))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func listOrNone(names []string) string {
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
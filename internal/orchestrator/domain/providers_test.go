@@ -0,0 +1,120 @@
+package domain_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/73NN0/foe-hammer/internal/orchestrator/domain"
+)
+
+func platformModules() []*domain.Module {
+	return []*domain.Module{
+		{Name: "platform-unix", Provides: []string{"platform"}, Conflicts: []string{"platform"}},
+		{Name: "platform-stub", Provides: []string{"platform"}, Conflicts: []string{"platform"}},
+		{Name: "libcore"},
+		{Name: "app", Depends: []string{"libcore", "platform"}},
+	}
+}
+
+func TestResolveProviders(t *testing.T) {
+	tests := []struct {
+		name     string
+		modules  []*domain.Module
+		sel      domain.ProviderSelection
+		wantDeps []string // resolved depends of app
+		wantKept []string // modules left once resolved
+		wantErr  error
+	}{
+		{
+			name:     "selected provider",
+			modules:  platformModules(),
+			sel:      domain.ProviderSelection{"platform": "platform-stub"},
+			wantDeps: []string{"libcore", "platform-stub"},
+			wantKept: []string{"platform-stub", "libcore", "app"},
+		},
+		{
+			name:    "ambiguous provider",
+			modules: platformModules(),
+			wantErr: domain.ErrProviderAmbiguous,
+		},
+		{
+			name:    "selected module doesn't provide",
+			modules: platformModules(),
+			sel:     domain.ProviderSelection{"platform": "libcore"},
+			wantErr: domain.ErrProviderMissing,
+		},
+		{
+			name: "single provider needs no selection",
+			modules: []*domain.Module{
+				{Name: "platform-unix", Provides: []string{"platform"}},
+				{Name: "app", Depends: []string{"platform"}},
+			},
+			wantDeps: []string{"platform-unix"},
+			wantKept: []string{"platform-unix", "app"},
+		},
+		{
+			name: "real module wins over virtual name",
+			modules: []*domain.Module{
+				{Name: "platform"},
+				{Name: "platform-unix", Provides: []string{"platform"}},
+				{Name: "app", Depends: []string{"platform"}},
+			},
+			wantDeps: []string{"platform"},
+			wantKept: []string{"platform", "platform-unix", "app"},
+		},
+		{
+			name: "conflicting modules",
+			modules: []*domain.Module{
+				{Name: "libssl", Conflicts: []string{"libressl"}},
+				{Name: "libressl"},
+				{Name: "app", Depends: []string{"libssl", "libressl"}},
+			},
+			wantErr: domain.ErrModuleConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolved, err := domain.ResolveProviders(tt.modules, tt.sel)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveProviders: %v", err)
+			}
+
+			var app *domain.Module
+			names := make([]string, 0, len(resolved))
+			for _, m := range resolved {
+				names = append(names, m.Name)
+				if m.Name == "app" {
+					app = m
+				}
+			}
+			if app == nil {
+				t.Fatalf("app was dropped: %v", names)
+			}
+			if !slices.Equal(app.Depends, tt.wantDeps) {
+				t.Errorf("expected app depends %v, got %v", tt.wantDeps, app.Depends)
+			}
+
+			// alternatives that were not chosen are dropped
+			if !slices.Equal(names, tt.wantKept) {
+				t.Errorf("expected modules %v, got %v", tt.wantKept, names)
+			}
+		})
+	}
+
+	// resolving doesn't touch the loaded modules
+	modules := platformModules()
+	if _, err := domain.ResolveProviders(modules, domain.ProviderSelection{"platform": "platform-unix"}); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(modules[3].Depends, []string{"libcore", "platform"}) {
+		t.Errorf("loaded module was modified: %v", modules[3].Depends)
+	}
+}
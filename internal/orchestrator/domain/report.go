@@ -0,0 +1,56 @@
+package domain
+
+// BuildStatus is what happened to a module during a build
+type BuildStatus string
+
+const (
+	BuildStatusBuilt    BuildStatus = "built"
+	BuildStatusUpToDate BuildStatus = "up-to-date"
+	BuildStatusCached   BuildStatus = "cached"
+	BuildStatusFailed   BuildStatus = "failed"
+	BuildStatusSkipped  BuildStatus = "skipped" // not built because a dependency failed or the build stopped
+)
+
+type ModuleResult struct {
+	Name   string
+	Status BuildStatus
+	Err    error // why it failed or was skipped
+}
+
+// BuildReport lists the result of every module of a build, in build order
+type BuildReport struct {
+	Results []ModuleResult
+}
+
+func (r *BuildReport) Add(result ModuleResult) {
+	r.Results = append(r.Results, result)
+}
+
+// Count returns how many modules ended with status
+func (r *BuildReport) Count(status BuildStatus) int {
+	n := 0
+	for _, res := range r.Results {
+		if res.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// Failed returns the names of the modules whose build failed
+func (r *BuildReport) Failed() []string {
+	var names []string
+	for _, res := range r.Results {
+		if res.Status == BuildStatusFailed {
+			names = append(names, res.Name)
+		}
+	}
+	return names
+}
+
+// TargetReport is the outcome of one target of a multi-target build
+type TargetReport struct {
+	Target Target
+	Report *BuildReport // nil when the target could not be planned
+	Err    error
+}
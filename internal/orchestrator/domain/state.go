@@ -0,0 +1,43 @@
+package domain
+
+import "slices"
+
+// BuildState is what foe remembers about the last successful build of each module in an out dir.
+// It is what makes incremental builds possible.
+type BuildState struct {
+	Modules map[string]ModuleState `json:"modules"`
+}
+
+// ModuleState describes the last successful build of a module
+type ModuleState struct {
+	Fingerprint string   `json:"fingerprint"` // hash of every input of the module, see app.fingerprint
+	Produces    []string `json:"produces"`
+}
+
+func NewBuildState() *BuildState {
+	return &BuildState{
+		Modules: make(map[string]ModuleState),
+	}
+}
+
+// UpToDate reports whether the module was last built from the same inputs
+// and declared the same produces.
+func (s *BuildState) UpToDate(name, fingerprint string, produces []string) bool {
+	last, ok := s.Modules[name]
+	if !ok {
+		return false
+	}
+	return last.Fingerprint == fingerprint && slices.Equal(last.Produces, produces)
+}
+
+func (s *BuildState) Record(name, fingerprint string, produces []string) {
+	s.Modules[name] = ModuleState{
+		Fingerprint: fingerprint,
+		Produces:    produces,
+	}
+}
+
+// Forget removes a module, so it is rebuilt next time
+func (s *BuildState) Forget(name string) {
+	delete(s.Modules, name)
+}
@@ -0,0 +1,93 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+var ErrUnsupportedDependency = errors.New("depends on a module that doesn't support the target")
+
+// Excluded is a module left out of a build because it doesn't support the target
+type Excluded struct {
+	Name     string
+	Reason   string   // arch=(x86_64) doesn't include arm64
+	Provides []string // virtual names it can no longer stand for
+}
+
+// Unsupported tells why the module can't be built for target (PKGBUILD arch=() and os=()),
+// "" when it can. Empty arrays and arch=(any) support every target.
+func (m *Module) Unsupported(target Target) string {
+	if len(m.Arch) > 0 && !m.NoArch() && !slices.ContainsFunc(m.Arch, target.IsArch) {
+		return fmt.Sprintf("arch=(%s) doesn't include %s", strings.Join(m.Arch, " "), target.Arch)
+	}
+	if len(m.OS) > 0 && !slices.Contains(m.OS, target.OS) {
+		return fmt.Sprintf("os=(%s) doesn't include %s", strings.Join(m.OS, " "), target.OS)
+	}
+	return ""
+}
+
+// FilterSupported splits modules between the ones supporting target and the excluded ones.
+func FilterSupported(modules []*Module, target Target) ([]*Module, []Excluded) {
+	var kept []*Module
+	var excluded []Excluded
+	for _, m := range modules {
+		if reason := m.Unsupported(target); reason != "" {
+			excluded = append(excluded, Excluded{Name: m.Name, Reason: reason, Provides: m.Provides})
+			continue
+		}
+		kept = append(kept, m)
+	}
+	return kept, excluded
+}
+
+// CheckExcluded fails when a kept module depends on an excluded one,
+// or on a virtual name only excluded modules provide,
+// so the build stops before anything is built instead of on a missing dependency.
+// kept is expected with its virtual depends already resolved, see ResolveProviders.
+func CheckExcluded(kept []*Module, excluded []Excluded, target Target) error {
+	reasons := make(map[string]string, len(excluded))
+	for _, e := range excluded {
+		reasons[e.Name] = e.Reason
+		for _, virtual := range e.Provides {
+			if reasons[virtual] != "" {
+				reasons[virtual] += ", "
+			}
+			reasons[virtual] += e.Name + " " + e.Reason
+		}
+	}
+	for _, m := range kept {
+		delete(reasons, m.Name)
+	}
+
+	var errs []error
+	for _, m := range kept {
+		for _, dep := range m.Depends {
+			if reason, ok := reasons[dep]; ok {
+				errs = append(errs, fmt.Errorf("%s %w %s: %s (%s)", m.Name, ErrUnsupportedDependency, target, dep, reason))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// CheckSelectedProviders fails when a selected provider (--provide, project defaults) is excluded,
+// with the reason, instead of ResolveProviders not finding it among the kept modules.
+func CheckSelectedProviders(sel ProviderSelection, excluded []Excluded, target Target) error {
+	reasons := make(map[string]string, len(excluded))
+	for _, e := range excluded {
+		reasons[e.Name] = e.Reason
+	}
+
+	var errs []error
+	for _, virtual := range slices.Sorted(maps.Keys(sel)) {
+		name := sel[virtual]
+		if reason, ok := reasons[name]; ok {
+			errs = append(errs, fmt.Errorf("%w for %s: %s was selected but doesn't support %s (%s)",
+				ErrProviderMissing, virtual, name, target, reason))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,99 @@
+package domain_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/73NN0/foe-hammer/internal/orchestrator/domain"
+)
+
+func TestUnsupported(t *testing.T) {
+	linuxArm := domain.Target{OS: "linux", Arch: "arm64"}
+
+	tests := []struct {
+		name   string
+		module domain.Module
+		want   string
+	}{
+		{name: "no restriction", module: domain.Module{}},
+		{name: "any", module: domain.Module{Arch: []string{"any"}}},
+		{name: "go arch name", module: domain.Module{Arch: []string{"arm64"}}},
+		{name: "gnu arch name", module: domain.Module{Arch: []string{"x86_64", "aarch64"}}},
+		{name: "os", module: domain.Module{OS: []string{"linux", "darwin"}}},
+		{
+			name:   "wrong arch",
+			module: domain.Module{Arch: []string{"x86_64"}},
+			want:   "arch=(x86_64) doesn't include arm64",
+		},
+		{
+			name:   "wrong os",
+			module: domain.Module{OS: []string{"windows"}},
+			want:   "os=(windows) doesn't include linux",
+		},
+		{
+			name:   "noarch but wrong os",
+			module: domain.Module{Arch: []string{"any"}, OS: []string{"windows"}},
+			want:   "os=(windows) doesn't include linux",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.module.Unsupported(linuxArm); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCheckExcluded(t *testing.T) {
+	windows := domain.Target{OS: "windows", Arch: "amd64"}
+	modules := []*domain.Module{
+		{Name: "platform-unix", OS: []string{"linux"}, Provides: []string{"platform"}},
+		{Name: "libunix", OS: []string{"linux"}},
+		{Name: "libcore"},
+		{Name: "app", Depends: []string{"libcore"}},
+		{Name: "tool", Depends: []string{"libunix"}},
+		{Name: "gui", Depends: []string{"platform"}},
+	}
+
+	kept, excluded := domain.FilterSupported(modules, windows)
+	if len(kept) != 4 || len(excluded) != 2 {
+		t.Fatalf("expected 4 kept and 2 excluded, got %d and %v", len(kept), excluded)
+	}
+
+	err := domain.CheckExcluded(kept, excluded, windows)
+	if !errors.Is(err, domain.ErrUnsupportedDependency) {
+		t.Fatalf("expected ErrUnsupportedDependency, got %v", err)
+	}
+	for _, want := range []string{"tool", "libunix (os=(linux) doesn't include windows)", "gui", "platform (platform-unix"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in %v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "app") {
+		t.Errorf("app only depends on supported modules: %v", err)
+	}
+}
+
+func TestCheckSelectedProviders(t *testing.T) {
+	windows := domain.Target{OS: "windows", Arch: "amd64"}
+	modules := []*domain.Module{
+		{Name: "platform-unix", OS: []string{"linux"}, Provides: []string{"platform"}},
+		{Name: "platform-win", OS: []string{"windows"}, Provides: []string{"platform"}},
+	}
+	_, excluded := domain.FilterSupported(modules, windows)
+
+	if err := domain.CheckSelectedProviders(domain.ProviderSelection{"platform": "platform-win"}, excluded, windows); err != nil {
+		t.Errorf("platform-win supports windows: %v", err)
+	}
+
+	err := domain.CheckSelectedProviders(domain.ProviderSelection{"platform": "platform-unix"}, excluded, windows)
+	if !errors.Is(err, domain.ErrProviderMissing) {
+		t.Fatalf("expected ErrProviderMissing, got %v", err)
+	}
+	if want := "os=(linux) doesn't include windows"; !strings.Contains(err.Error(), want) {
+		t.Errorf("expected the exclusion reason %q in %v", want, err)
+	}
+}
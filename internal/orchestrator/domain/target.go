@@ -1,18 +1,42 @@
 package domain
 
 import (
+	"errors"
 	"fmt"
 	"runtime"
+	"strings"
 )
 
-// for what platform we want to compile to
+var ErrInvalidTarget = errors.New("invalid target")
+
+// AnyTarget is the target noarch modules (arch=(any)) are built for
+var AnyTarget = Target{OS: "any", Arch: "any"}
+
+// for what platform we want to compile to.
+// OS and Arch are Go names whatever was parsed (x86_64 => amd64),
+// Vendor and ABI are empty for the OS default, see ParseTarget.
 type Target struct {
-	OS   string // win32 linux darwin android
-	Arch string // x86_64, arm64 etc...
+	OS     string // windows linux darwin android
+	Arch   string // amd64, arm64 etc...
+	Vendor string // pc, apple, unknown...
+	ABI    string // gnu, musl, msvc, eabihf...
 }
 
+// String returns the name of the target in out dirs and project config:
+// <arch>-<os>, with the vendor and the ABI only when they are not the default ones.
+//
+//	Target{OS: "linux", Arch: "amd64"}              => amd64-linux
+//	Target{OS: "linux", Arch: "arm64", ABI: "musl"} => arm64-linux-musl
 func (t Target) String() string {
-	return fmt.Sprintf("%v-%v", t.Arch, t.OS)
+	parts := []string{t.Arch}
+	if t.Vendor != "" {
+		parts = append(parts, t.Vendor)
+	}
+	parts = append(parts, t.OS)
+	if t.ABI != "" {
+		parts = append(parts, t.ABI)
+	}
+	return strings.Join(parts, "-")
 }
 
 func NewTarget() Target {
@@ -21,3 +45,200 @@ func NewTarget() Target {
 	target.Arch = runtime.GOARCH
 	return target
 }
+
+// GNU names of Go architectures, PKGBUILDs use both (depends_x86_64, depends_amd64)
+var archAliases = map[string]string{
+	"amd64":   "x86_64",
+	"386":     "i686",
+	"arm64":   "aarch64",
+	"ppc64le": "powerpc64le",
+	"ppc64":   "powerpc64",
+}
+
+// Go names of GNU architectures, see NormalizeArch
+var goArchs = map[string]string{
+	"x86_64":      "amd64",
+	"i386":        "386",
+	"i486":        "386",
+	"i586":        "386",
+	"i686":        "386",
+	"aarch64":     "arm64",
+	"armv6":       "arm",
+	"armv7":       "arm",
+	"armv7l":      "arm",
+	"armhf":       "arm",
+	"powerpc64le": "ppc64le",
+	"powerpc64":   "ppc64",
+}
+
+// Go names of GNU operating systems, see NormalizeOS
+var goOSes = map[string]string{
+	"mingw32": "windows",
+	"win32":   "windows",
+	"macos":   "darwin",
+	"macosx":  "darwin",
+}
+
+// operating systems recognized in the second part of a triple,
+// aarch64-linux-gnu is arch-os-abi while x86_64-pc-windows is arch-vendor-os
+var knownOSes = map[string]bool{
+	"linux": true, "darwin": true, "windows": true, "android": true, "ios": true,
+	"freebsd": true, "netbsd": true, "openbsd": true, "dragonfly": true,
+	"plan9": true, "solaris": true, "illumos": true, "aix": true,
+	"mingw32": true, "win32": true, "macos": true, "macosx": true, "none": true, "any": true,
+}
+
+// NormalizeArch returns the Go name of an architecture, GNU or Go (x86_64 => amd64)
+func NormalizeArch(arch string) string {
+	if goArch, ok := goArchs[arch]; ok {
+		return goArch
+	}
+	return arch
+}
+
+// NormalizeOS returns the Go name of an operating system (mingw32 => windows)
+func NormalizeOS(os string) string {
+	if goOS, ok := goOSes[os]; ok {
+		return goOS
+	}
+	return os
+}
+
+// GNUArch returns the GNU name of the target architecture (amd64 => x86_64),
+// the architecture itself when it has no other name.
+func (t Target) GNUArch() string {
+	if alias, ok := archAliases[t.Arch]; ok {
+		return alias
+	}
+	return t.Arch
+}
+
+// IsArch reports whether arch names the target architecture, by its Go or GNU name
+func (t Target) IsArch(arch string) bool {
+	return NormalizeArch(arch) == t.Arch
+}
+
+// Triple returns the GNU triple of the target, what cross compilers are named after:
+//
+//	Target{OS: "linux", Arch: "arm64"}   => aarch64-linux-gnu
+//	Target{OS: "windows", Arch: "amd64"} => x86_64-w64-mingw32
+//	Target{OS: "darwin", Arch: "arm64"}  => aarch64-apple-darwin
+func (t Target) Triple() string {
+	parts := []string{t.GNUArch()}
+	if vendor := t.vendor(); vendor != "" {
+		parts = append(parts, vendor)
+	}
+
+	switch {
+	case t.OS == "windows" && t.ABI == "":
+		parts = append(parts, "mingw32")
+	case t.OS == "android":
+		parts = append(parts, "linux", "android"+t.ABI)
+	default:
+		parts = append(parts, t.OS)
+		if abi := t.abi(); abi != "" {
+			parts = append(parts, abi)
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+// vendor returns the vendor of the triple, the default one of the OS when unset
+func (t Target) vendor() string {
+	if t.Vendor != "" {
+		return t.Vendor
+	}
+	return defaultVendor(t.OS, t.ABI)
+}
+
+func (t Target) abi() string {
+	if t.ABI != "" {
+		return t.ABI
+	}
+	return defaultABI(t.OS)
+}
+
+func defaultVendor(os, abi string) string {
+	switch os {
+	case "darwin", "ios":
+		return "apple"
+	case "windows":
+		if abi == "" {
+			return "w64" // mingw
+		}
+		return "pc"
+	}
+	return ""
+}
+
+func defaultABI(os string) string {
+	if os == "linux" {
+		return "gnu"
+	}
+	return ""
+}
+
+// Suffixes returns the PKGBUILD array suffixes matching the target,
+// from the least to the most specific:
+//
+//	Target{OS: "linux", Arch: "amd64"} => linux amd64 x86_64 linux_amd64 linux_x86_64
+func (t Target) Suffixes() []string {
+	archs := []string{t.Arch}
+	if alias, ok := archAliases[t.Arch]; ok {
+		archs = append(archs, alias)
+	}
+
+	suffixes := []string{t.OS}
+	suffixes = append(suffixes, archs...)
+	for _, arch := range archs {
+		suffixes = append(suffixes, t.OS+"_"+arch)
+	}
+	return suffixes
+}
+
+// ParseTarget parses a target as printed by String ("amd64-linux"),
+// as GOOS/GOARCH ("linux/amd64") or as a GNU triple ("aarch64-linux-gnu", "x86_64-pc-windows-msvc").
+// Names are normalized, so "x86_64-linux-gnu" and "amd64-linux" are the same target.
+func ParseTarget(s string) (Target, error) {
+	var t Target
+	if os, arch, ok := strings.Cut(s, "/"); ok {
+		t = Target{OS: os, Arch: arch}
+	} else {
+		parts := strings.Split(s, "-")
+		switch {
+		case len(parts) == 2:
+			t = Target{Arch: parts[0], OS: parts[1]}
+		case len(parts) == 3 && knownOSes[parts[1]]:
+			t = Target{Arch: parts[0], OS: parts[1], ABI: parts[2]}
+		case len(parts) == 3:
+			t = Target{Arch: parts[0], Vendor: parts[1], OS: parts[2]}
+		case len(parts) == 4:
+			t = Target{Arch: parts[0], Vendor: parts[1], OS: parts[2], ABI: parts[3]}
+		}
+	}
+
+	if t.OS == "" || t.Arch == "" || strings.Contains(t.OS, "/") || strings.Contains(t.Arch, "/") {
+		return Target{}, fmt.Errorf("%w: %q, expected <arch>-<os>, <os>/<arch> or a GNU triple", ErrInvalidTarget, s)
+	}
+	return t.normalize(), nil
+}
+
+// normalize turns GNU names into Go ones and drops the default vendor and ABI
+func (t Target) normalize() Target {
+	t.Arch = NormalizeArch(t.Arch)
+	t.OS = NormalizeOS(t.OS)
+
+	// aarch64-linux-android
+	if t.OS == "linux" && strings.HasPrefix(t.ABI, "android") {
+		t.OS = "android"
+		t.ABI = strings.TrimPrefix(t.ABI, "android")
+	}
+
+	if t.Vendor == "unknown" || t.Vendor == defaultVendor(t.OS, t.ABI) {
+		t.Vendor = ""
+	}
+	if t.ABI == defaultABI(t.OS) {
+		t.ABI = ""
+	}
+	return t
+}
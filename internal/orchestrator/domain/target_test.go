@@ -0,0 +1,94 @@
+package domain_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/73NN0/foe-hammer/internal/orchestrator/domain"
+)
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    domain.Target
+		wantErr bool
+	}{
+		{in: "amd64-linux", want: domain.Target{OS: "linux", Arch: "amd64"}},
+		{in: "linux/arm64", want: domain.Target{OS: "linux", Arch: "arm64"}},
+		{in: "x86_64-windows", want: domain.Target{OS: "windows", Arch: "amd64"}},
+		// GNU triples
+		{in: "aarch64-linux-gnu", want: domain.Target{OS: "linux", Arch: "arm64"}},
+		{in: "x86_64-unknown-linux-gnu", want: domain.Target{OS: "linux", Arch: "amd64"}},
+		{in: "x86_64-linux-musl", want: domain.Target{OS: "linux", Arch: "amd64", ABI: "musl"}},
+		{in: "armv7-linux-gnueabihf", want: domain.Target{OS: "linux", Arch: "arm", ABI: "gnueabihf"}},
+		{in: "x86_64-w64-mingw32", want: domain.Target{OS: "windows", Arch: "amd64"}},
+		{in: "x86_64-pc-windows-msvc", want: domain.Target{OS: "windows", Arch: "amd64", ABI: "msvc"}},
+		{in: "aarch64-apple-darwin", want: domain.Target{OS: "darwin", Arch: "arm64"}},
+		{in: "aarch64-linux-android", want: domain.Target{OS: "android", Arch: "arm64"}},
+		{in: "i686-acme-myos", want: domain.Target{OS: "myos", Arch: "386", Vendor: "acme"}},
+		{in: "linux", wantErr: true},
+		{in: "-linux", wantErr: true},
+		{in: "linux/", wantErr: true},
+		{in: "a-b-c-d-e", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := domain.ParseTarget(tt.in)
+			if tt.wantErr {
+				if !errors.Is(err, domain.ErrInvalidTarget) {
+					t.Fatalf("expected ErrInvalidTarget, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseTarget: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+			// String, Triple and ParseTarget round trip
+			if again, _ := domain.ParseTarget(got.String()); again != got {
+				t.Errorf("round trip: %s gave %+v", got, again)
+			}
+			if again, _ := domain.ParseTarget(got.Triple()); again != got {
+				t.Errorf("round trip: %s gave %+v", got.Triple(), again)
+			}
+		})
+	}
+}
+
+func TestTriple(t *testing.T) {
+	tests := []struct {
+		target domain.Target
+		want   string
+	}{
+		{domain.Target{OS: "linux", Arch: "amd64"}, "x86_64-linux-gnu"},
+		{domain.Target{OS: "linux", Arch: "arm64", ABI: "musl"}, "aarch64-linux-musl"},
+		{domain.Target{OS: "windows", Arch: "amd64"}, "x86_64-w64-mingw32"},
+		{domain.Target{OS: "windows", Arch: "arm64", ABI: "msvc"}, "aarch64-pc-windows-msvc"},
+		{domain.Target{OS: "darwin", Arch: "arm64"}, "aarch64-apple-darwin"},
+		{domain.Target{OS: "android", Arch: "arm64"}, "aarch64-linux-android"},
+		{domain.Target{OS: "plan9", Arch: "386"}, "i686-plan9"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.target.Triple(); got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.target, tt.want, got)
+		}
+	}
+}
+
+func TestNormalizeArch(t *testing.T) {
+	for in, want := range map[string]string{
+		"x86_64":  "amd64",
+		"amd64":   "amd64",
+		"aarch64": "arm64",
+		"i686":    "386",
+		"riscv64": "riscv64",
+	} {
+		if got := domain.NormalizeArch(in); got != want {
+			t.Errorf("%s: expected %s, got %s", in, want, got)
+		}
+	}
+}
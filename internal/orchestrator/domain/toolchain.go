@@ -0,0 +1,15 @@
+package domain
+
+// Toolchain tells the hooks how to compile for a target,
+// so build() uses "$FOE_CC" instead of hard-coding clang.
+type Toolchain struct {
+	Name     string // linux-arm64 for toolchains/linux-arm64.toolchain
+	CC       string
+	CXX      string
+	AR       string
+	LD       string
+	Sysroot  string // absolute
+	CFlags   string
+	CXXFlags string
+	LDFlags  string
+}